@@ -5,19 +5,28 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+var (
+	// The modification time of assets from an AssetFS without a ModTime, the
+	// time the running binary containing them started.
+	assetsModTime = time.Now()
+)
+
 type (
 	FakeFile struct {
-		Path string
-		Dir  bool
-		Len  int64
+		Path     string
+		Dir      bool
+		Len      int64
+		Modified time.Time
 	}
 
 	AssetFile struct {
@@ -33,8 +42,9 @@ type (
 	}
 
 	// A pseudo-file structure constructed from functions & optional prefix
-	// Flotilla can use binary data, and is the current optimal way to define
-	// inbuilt assets for extensions.
+	// Flotilla can use binary data, as generated by go-bindata. An AssetFS is
+	// an http.FileSystem, and its FS an fs.FS usable in Assets alongside any
+	// other fs.FS, e.g. an embed.FS.
 	// See:
 	// https://github.com/jteeuwen/go-bindata
 	// https://github.com/elazarl/go-bindata-assetfs
@@ -43,10 +53,17 @@ type (
 		AssetDir   func(string) ([]string, error)
 		AssetNames func() []string
 		Prefix     string
+		ModTime    time.Time
+	}
+
+	// assetFSys adapts an AssetFS to fs.FS.
+	assetFSys struct {
+		assetfs *AssetFS
 	}
 
-	// An array of AssetFS instances
-	Assets []*AssetFS
+	// An array of fs.FS instances, AssetFS or any other fs.FS such as an
+	// embed.FS, containing templates & static files for the App.
+	Assets []fs.FS
 )
 
 func (f *FakeFile) Name() string {
@@ -63,7 +80,7 @@ func (f *FakeFile) Mode() os.FileMode {
 }
 
 func (f *FakeFile) ModTime() time.Time {
-	return time.Unix(0, 0)
+	return f.Modified
 }
 
 func (f *FakeFile) Size() int64 {
@@ -82,10 +99,16 @@ func NewAssetFile(name string, content []byte) *AssetFile {
 	return &AssetFile{
 		bytes.NewReader(content),
 		ioutil.NopCloser(nil),
-		FakeFile{name, false, int64(len(content))},
+		FakeFile{name, false, int64(len(content)), assetsModTime},
 	}
 }
 
+// Size resolves the Size of the embedded *bytes.Reader & FakeFile to the full
+// length of the file.
+func (f *AssetFile) Size() int64 {
+	return f.FakeFile.Len
+}
+
 func (f *AssetFile) Readdir(count int) ([]os.FileInfo, error) {
 	return nil, errors.New("not a directory")
 }
@@ -98,13 +121,13 @@ func NewAssetDirectory(name string, children []string, fs *AssetFS) *AssetDirect
 	fileinfos := make([]os.FileInfo, 0, len(children))
 	for _, child := range children {
 		_, err := fs.AssetDir(filepath.Join(name, child))
-		fileinfos = append(fileinfos, &FakeFile{child, err == nil, 0})
+		fileinfos = append(fileinfos, &FakeFile{child, err == nil, 0, assetsModTime})
 	}
 	return &AssetDirectory{
 		AssetFile{
 			bytes.NewReader(nil),
 			ioutil.NopCloser(nil),
-			FakeFile{name, true, 0},
+			FakeFile{name, true, 0, assetsModTime},
 		},
 		0,
 		fileinfos}
@@ -127,9 +150,30 @@ func (f *AssetDirectory) Stat() (os.FileInfo, error) {
 	return f, nil
 }
 
+// ReadDir returns the next count children of the directory, or all remaining
+// children where count <= 0, implementing fs.ReadDirFile.
+func (f *AssetDirectory) ReadDir(count int) ([]fs.DirEntry, error) {
+	n := len(f.Children) - f.ChildrenRead
+	if count > 0 && n == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < n {
+		n = count
+	}
+	entries := make([]fs.DirEntry, 0, n)
+	for _, child := range f.Children[f.ChildrenRead : f.ChildrenRead+n] {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+	f.ChildrenRead += n
+	return entries, nil
+}
+
+// HasAsset returns the name of the asset exactly matching the requested slash
+// separated path.
 func (fs *AssetFS) HasAsset(requested string) (string, bool) {
+	requested = strings.TrimPrefix(requested, "/")
 	for _, filename := range fs.AssetNames() {
-		if path.Base(filename) == requested {
+		if filename == requested {
 			return filename, true
 		}
 	}
@@ -144,6 +188,12 @@ func (fs *AssetFS) GetAsset(requested string) (http.File, error) {
 	return nil, newError("asset %s unvailable", requested)
 }
 
+// FS returns the AssetFS as an fs.FS, for use in Assets.
+func (fs *AssetFS) FS() fs.FS {
+	return assetFSys{fs}
+}
+
+// Open opens the named asset or asset directory, implementing http.FileSystem.
 func (fs *AssetFS) Open(name string) (http.File, error) {
 	name = path.Join(fs.Prefix, name)
 	if len(name) > 0 && name[0] == '/' {
@@ -156,14 +206,92 @@ func (fs *AssetFS) Open(name string) (http.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewAssetFile(name, b), nil
+	f := NewAssetFile(name, b)
+	if !fs.ModTime.IsZero() {
+		f.Modified = fs.ModTime
+	}
+	return f, nil
 }
 
-// Return the requested asset as http.File from the AssetFS's contained
+// Open opens the named asset or asset directory, implementing fs.FS. The name
+// must be valid by fs.ValidPath, with "." the root of the AssetFS.
+func (x assetFSys) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	requested := name
+	if requested == "." {
+		requested = ""
+	}
+	f, err := x.assetfs.Open(requested)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
+// assetNames returns the slash separated names of all files in fsys.
+func assetNames(fsys fs.FS) []string {
+	if x, ok := fsys.(assetFSys); ok {
+		return x.assetfs.AssetNames()
+	}
+	var names []string
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}
+
+// hasAsset returns the name of the file in fsys exactly matching the requested
+// slash separated path, as AssetFS.HasAsset.
+func hasAsset(fsys fs.FS, requested string) (string, bool) {
+	if x, ok := fsys.(assetFSys); ok {
+		return x.assetfs.HasAsset(requested)
+	}
+	requested = strings.TrimPrefix(requested, "/")
+	if fi, err := fs.Stat(fsys, requested); err == nil && !fi.IsDir() {
+		return requested, true
+	}
+	return "", false
+}
+
+// getAsset returns the requested file of fsys as an http.File.
+func getAsset(fsys fs.FS, requested string) (http.File, error) {
+	if x, ok := fsys.(assetFSys); ok {
+		return x.assetfs.GetAsset(requested)
+	}
+	name, ok := hasAsset(fsys, requested)
+	if !ok {
+		return nil, newError("asset %s unavailable", requested)
+	}
+	return openAsset(fsys, name)
+}
+
+// openAsset returns the file of fsys with exactly the slash separated name as
+// an http.File.
+func openAsset(fsys fs.FS, name string) (http.File, error) {
+	if x, ok := fsys.(assetFSys); ok {
+		return x.assetfs.Open(name)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	f := NewAssetFile(name, b)
+	if fi, err := fs.Stat(fsys, name); err == nil && !fi.ModTime().IsZero() {
+		f.Modified = fi.ModTime()
+	}
+	return f, nil
+}
+
+// Return the requested asset as http.File from the fs.FS's contained
 // in Asset, by supplying a string
 func (a Assets) Get(requested string) (http.File, error) {
 	for _, x := range a {
-		f, err := x.GetAsset(requested)
+		f, err := getAsset(x, requested)
 		if err == nil {
 			return f, nil
 		}
@@ -171,9 +299,39 @@ func (a Assets) Get(requested string) (http.File, error) {
 	return nil, newError("asset %s unavailable", requested)
 }
 
+// getIn returns the requested asset by its exact path under a directory of the
+// assets named as the base of any of dirs, e.g. "templates/index.html" for
+// "index.html" with the directory ".../templates", or else by the requested
+// path itself.
+func (a Assets) getIn(dirs []string, requested string) (http.File, error) {
+	for _, base := range dirBases(dirs) {
+		if f, err := a.Get(path.Join(base, requested)); err == nil {
+			return f, nil
+		}
+	}
+	return a.Get(requested)
+}
+
+// dirBases returns the distinct base names of dirs, as directories of assets.
+func dirBases(dirs []string) []string {
+	var bases []string
+	for _, dir := range dirs {
+		if base := filepath.Base(dir); base != "." && base != string(filepath.Separator) && !existsIn(base, bases) {
+			bases = append(bases, base)
+		}
+	}
+	return bases
+}
+
 func (a Assets) GetByte(requested string) ([]byte, error) {
 	for _, x := range a {
-		b, err := x.Asset(requested)
+		var b []byte
+		var err error
+		if assetfs, ok := x.(assetFSys); ok {
+			b, err = assetfs.assetfs.Asset(requested)
+		} else {
+			b, err = fs.ReadFile(x, strings.TrimPrefix(requested, "/"))
+		}
 		if err == nil {
 			return b, nil
 		}
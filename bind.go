@@ -0,0 +1,304 @@
+package flotilla
+
+import (
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	durationType    = reflect.TypeOf(time.Duration(0))
+)
+
+type (
+	// BindError is an error binding a single request value, or the request
+	// body where Field is empty, to a struct.
+	BindError struct {
+		Field string `json:"field,omitempty"`
+		Name  string `json:"name,omitempty"`
+		Value string `json:"value,omitempty"`
+		Err   string `json:"error"`
+	}
+
+	// BindErrors collects all errors from binding a request to a struct.
+	BindErrors []*BindError
+
+	binder struct {
+		form   url.Values
+		files  map[string][]*multipart.FileHeader
+		errors BindErrors
+		// embedded pointer types being bound, so a type embedding a pointer
+		// to itself is bound once
+		embedding map[reflect.Type]bool
+	}
+)
+
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return e.Err
+	}
+	return e.Field + ": " + e.Err
+}
+
+func (e BindErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Form returns the parsed url query & form values of the request.
+func (ctx *Ctx) Form() url.Values {
+	if ctx.current != nil {
+		return ctx.current.Form()
+	}
+	ctx.parseMultipart()
+	return ctx.Request.Form
+}
+
+// Files returns the files of a multipart request.
+func (ctx *Ctx) Files() map[string][]*multipart.FileHeader {
+	if ctx.current != nil {
+		return ctx.current.Files()
+	}
+	ctx.parseMultipart()
+	if ctx.Request.MultipartForm != nil {
+		return ctx.Request.MultipartForm.File
+	}
+	return nil
+}
+
+// uploadSize is the [upload] size of the Env Store, in bytes, limiting the
+// request body read.
+func (ctx *Ctx) uploadSize() int64 {
+	size, err := ctx.App.Env.Store["UPLOAD_SIZE"].Int64()
+	if err != nil {
+		size = 10000000
+	}
+	return size
+}
+
+func (ctx *Ctx) parseMultipart() {
+	if ctx.Request.Form == nil {
+		if err := ctx.Request.ParseMultipartForm(ctx.uploadSize()); err != nil {
+			ctx.Request.ParseForm()
+		}
+	}
+}
+
+func bind(ctx *Ctx, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return newError("cannot bind to %T, not a pointer to a struct", v)
+	}
+	b := &binder{embedding: make(map[reflect.Type]bool)}
+	b.defaults(rv.Elem())
+	ctype, _, _ := mime.ParseMediaType(ctx.Request.Header.Get("Content-Type"))
+	switch {
+	case ctx.Request.Body == nil || ctx.Request.ContentLength == 0 || ctype == "":
+		b.form = ctx.Request.URL.Query()
+	case ctype == "application/json":
+		body := http.MaxBytesReader(ctx.rw, ctx.Request.Body, ctx.uploadSize())
+		if err := json.NewDecoder(body).Decode(v); err != nil {
+			return BindErrors{&BindError{Err: err.Error()}}
+		}
+		return nil
+	case ctype == "application/x-www-form-urlencoded":
+		b.form = ctx.Form()
+	case ctype == "multipart/form-data":
+		b.form, b.files = ctx.Form(), ctx.Files()
+	default:
+		return BindErrors{&BindError{Err: "unsupported content type " + ctype}}
+	}
+	b.bind(rv.Elem())
+	if len(b.errors) > 0 {
+		return b.errors
+	}
+	return nil
+}
+
+// Bind decodes the request into the struct pointed to by v, using the Ctx
+// bind function. The decoder is picked by request Content-Type:
+// application/json bodies, read up to the [upload] size, with encoding/json,
+// and the url query, urlencoded or multipart forms by the "form" tag of each
+// field, or the field name. Fields of embedded structs, or of embedded
+// pointers to structs allocated where nil, are bound as fields of v.
+// Multipart files are bound to *multipart.FileHeader or
+// []*multipart.FileHeader fields. A field left without a value is set from
+// any "default" tag, e.g.
+//
+// 	type Search struct {
+// 		Query  string                `form:"q"`
+// 		Page   int                   `form:"page" default:"1"`
+// 		Upload *multipart.FileHeader `form:"upload"`
+// 	}
+//
+// An error for any value that cannot be bound is returned as BindErrors.
+func (ctx *Ctx) Bind(v interface{}) error {
+	ret, err := ctx.Call("bind", ctx, v)
+	if err != nil {
+		return err
+	}
+	if err, ok := ret.(error); ok {
+		return err
+	}
+	return nil
+}
+
+func bindName(field reflect.StructField) (string, bool) {
+	name := field.Tag.Get("form")
+	if name == "-" || field.PkgPath != "" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// embedded calls fn with the struct of an embedded struct or pointer to
+// struct field, allocating a nil pointer, returning false for any other field.
+func (b *binder) embedded(field reflect.StructField, fv reflect.Value, fn func(reflect.Value)) bool {
+	if !field.Anonymous {
+		return false
+	}
+	switch {
+	case field.Type.Kind() == reflect.Struct:
+		fn(fv)
+	case field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct && field.Type != fileHeaderType:
+		if b.embedding[field.Type] {
+			return true
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(field.Type.Elem()))
+		}
+		b.embedding[field.Type] = true
+		fn(fv.Elem())
+		delete(b.embedding, field.Type)
+	default:
+		return false
+	}
+	return true
+}
+
+// defaults sets fields of the struct with a "default" tag.
+func (b *binder) defaults(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := bindName(field); !ok {
+			continue
+		}
+		if b.embedded(field, v.Field(i), b.defaults) {
+			continue
+		}
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if err := setValue(v.Field(i), []string{def}); err != nil {
+				b.errors = append(b.errors, &BindError{field.Name, "", def, "default: " + err.Error()})
+			}
+		}
+	}
+}
+
+// bind sets fields of the struct from the binder form & files.
+func (b *binder) bind(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := bindName(field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		switch {
+		case b.embedded(field, fv, b.bind):
+		case field.Type == fileHeaderType:
+			if fhs := b.files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs[0]))
+			}
+		case field.Type == fileHeadersType:
+			if fhs := b.files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs))
+			}
+		default:
+			if values, ok := b.form[name]; ok && len(values) > 0 {
+				if err := setValue(fv, values); err != nil {
+					b.errors = append(b.errors, &BindError{field.Name, name, strings.Join(values, ","), err.Error()})
+				}
+			}
+		}
+	}
+}
+
+// setValue sets v from string values, the first for a single value, or all
+// for a slice.
+func setValue(v reflect.Value, values []string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	value := values[0]
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			if value != "on" {
+				return newError("%q is not a boolean", value)
+			}
+			b = true
+		}
+		v.SetBool(b)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return newError("%q is not an integer", value)
+		}
+		v.SetInt(n)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return newError("%q is not an unsigned integer", value)
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return newError("%q is not a number", value)
+		}
+		v.SetFloat(n)
+	default:
+		return newError("cannot bind to %s", v.Type())
+	}
+	return nil
+}
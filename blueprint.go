@@ -1,6 +1,7 @@
 package flotilla
 
 import (
+	"io/fs"
 	"path/filepath"
 
 	"golang.org/x/net/context"
@@ -21,6 +22,7 @@ type (
 		children      []*Blueprint
 		routes        Routes
 		ctxprocessors map[string]interface{}
+		sessionless   bool
 		Prefix        string
 		Handlers      []HandlerFunc
 	}
@@ -122,6 +124,7 @@ func (b *Blueprint) NewBlueprint(component string, handlers ...HandlerFunc) *Blu
 	newb := NewBlueprint(prefix)
 	newb.ctxprocessors = b.ctxprocessors
 	newb.Handlers = b.combineHandlers(handlers)
+	newb.sessionless = b.sessionless
 
 	b.children = append(b.children, newb)
 
@@ -237,11 +240,24 @@ func (b *Blueprint) CtxProcessors(cp map[string]interface{}) {
 	}
 }
 
+// DisableSessions opts all routes of the Blueprint, and child Blueprints created
+// from it afterwards, out of sessions, as Route.DisableSessions.
+func (b *Blueprint) DisableSessions() {
+	b.sessionless = true
+	for _, rt := range b.routes {
+		rt.DisableSessions()
+	}
+}
+
 func (b *Blueprint) register(route *Route) {
 	route.blueprint = b
+	if b.sessionless {
+		route.DisableSessions()
+	}
 	route.handlers = b.combineHandlers(route.handlers)
 	route.CtxProcessors(b.ctxprocessors)
 	route.path = b.pathFor(route.base)
+	route.compile(b.app.Env)
 	route.p.New = route.newCtx
 	route.registered = true
 }
@@ -253,7 +269,7 @@ func (b *Blueprint) Handle(route *Route) {
 	register := func() {
 		b.register(route)
 		b.add(route)
-		b.app.Take(route.path, route.method, route.handle)
+		b.app.Take(route.enginePath(), route.method, route.handle)
 	}
 	b.push(register, route)
 }
@@ -292,11 +308,22 @@ func (b *Blueprint) STATIC(path string) {
 	b.Handle(NewRoute("GET", path, true, []HandlerFunc{handleStatic}))
 }
 
+// TemplateNamespace adds any number of fs.FS to the named template namespace of
+// the app the blueprint is registered with, e.g. templates of the blueprint
+// loaded as "admin:list.html".
+func (b *Blueprint) TemplateNamespace(namespace string, fsys ...fs.FS) {
+	b.push(func() { b.app.AddTemplateNamespace(namespace, fsys...) }, nil)
+}
+
 // Custom HttpStatus for the group, set and called from engine HttpStatuses
 func (b *Blueprint) StatusHandle(code int, handlers ...HandlerFunc) {
 	statushandler := func(c context.Context) {
 		curr := c.Value("Current").(Current)
 		statusCtx := b.app.tmpCtx(curr.Writer(), curr.Request())
+		statusCtx.Data = curr.Data()
+		if errs, ok := statusCtx.Data["Errors"].(errorMsgs); ok {
+			statusCtx.errors = errs
+		}
 		s := len(handlers)
 		for i := 0; i < s; i++ {
 			handlers[i](statusCtx)
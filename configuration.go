@@ -1,6 +1,9 @@
 package flotilla
 
-import "strings"
+import (
+	"io/fs"
+	"strings"
+)
 
 var (
 	configureLast = []Configuration{cblueprints,
@@ -47,12 +50,30 @@ func csession(a *App) error {
 }
 
 func ctemplating(a *App) error {
+	if _, ok := a.tplfunctions["url"]; !ok {
+		a.AddTplFunc("url", func(route string, params ...interface{}) string {
+			url, err := a.UrlFor(route, params...)
+			if err != nil {
+				return err.Error()
+			}
+			return url
+		})
+	}
 	a.Env.TemplatorInit()
 	return nil
 }
 
 func cstatic(a *App) error {
 	a.Env.StaticorInit()
+	if _, ok := a.tplfunctions["staticurl"]; !ok {
+		a.AddTplFunc("staticurl", func(requested string) string {
+			url, err := a.StaticUrl(requested)
+			if err != nil {
+				return err.Error()
+			}
+			return url
+		})
+	}
 	return nil
 }
 
@@ -100,6 +121,15 @@ func EnvItem(items ...string) Configuration {
 	}
 }
 
+// Asset adds any number of fs.FS, e.g. an embed.FS or AssetFS.FS(), to the App
+// Assets, from which templates & static files are served.
+func Asset(fsys ...fs.FS) Configuration {
+	return func(a *App) error {
+		a.Env.AddAssets(fsys...)
+		return nil
+	}
+}
+
 // CtxFunc adds a single function accessible as a Context Function.
 func CtxFunc(name string, fn interface{}) Configuration {
 	return func(a *App) error {
@@ -114,9 +144,12 @@ func CtxFuncs(fns map[string]interface{}) Configuration {
 	}
 }
 
-// Templating supplies a Templator to the App.
+// Templating supplies a Templator to the App, e.g. NewHTMLTemplator(nil).
 func Templating(t Templator) Configuration {
 	return func(a *App) error {
+		if et, ok := t.(envTemplator); ok {
+			et.setEnv(a.Env)
+		}
 		a.Env.Templator = t
 		return nil
 	}
@@ -138,6 +171,32 @@ func TemplateFunctions(fns map[string]interface{}) Configuration {
 	}
 }
 
+// TemplateNamespace adds any number of fs.FS to the named template namespace,
+// from which templates are loaded by names of the form "namespace:name".
+func TemplateNamespace(namespace string, fsys ...fs.FS) Configuration {
+	return func(a *App) error {
+		a.Env.AddTemplateNamespace(namespace, fsys...)
+		return nil
+	}
+}
+
+// Validator adds a ValidatorFunc used by the rule name in validate tags.
+func Validator(name string, fn ValidatorFunc) Configuration {
+	return func(a *App) error {
+		a.Env.AddValidator(name, fn)
+		return nil
+	}
+}
+
+// RouteConverter adds a ConverterFunc used by the converter name in route
+// patterns, e.g. RouteConverter("hex", fn) for "/color/:color<hex>".
+func RouteConverter(name string, fn ConverterFunc) Configuration {
+	return func(a *App) error {
+		a.Env.AddConverter(name, fn)
+		return nil
+	}
+}
+
 // CtxProcessor adds a single template context processor to the App primary
 // Blueprint. This will affect all Blueprints & Routes.
 func CtxProcessor(name string, fn interface{}) Configuration {
@@ -0,0 +1,281 @@
+package flotilla
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	builtinconverters = map[string]ConverterFunc{
+		"string": func(string) (Converter, error) { return stringConverter{}, nil },
+		"int":    func(string) (Converter, error) { return intConverter{}, nil },
+		"float":  func(string) (Converter, error) { return floatConverter{}, nil },
+		"uuid":   func(string) (Converter, error) { return uuidConverter{}, nil },
+		"path":   func(string) (Converter, error) { return pathConverter{}, nil },
+		"re":     newRegexpConverter,
+	}
+)
+
+type (
+	// A Converter validates & converts the value of a route parameter matched
+	// from a request path, and formats a value as a route parameter for urls.
+	Converter interface {
+		// Convert returns the converted value, or an error where the value
+		// does not match.
+		Convert(string) (interface{}, error)
+		// Format returns the value as a route parameter, or an error where the
+		// value would not match.
+		Format(interface{}) (string, error)
+	}
+
+	// ConverterFunc returns a Converter for any argument given in a route
+	// pattern, e.g. "[a-z-]+" for :slug<re:[a-z-]+>
+	ConverterFunc func(arg string) (Converter, error)
+
+	// routeSegment is a single segment of a route path, static or a :param or
+	// *splat with any Converter.
+	routeSegment struct {
+		kind      byte
+		value     string
+		converter Converter
+	}
+
+	stringConverter struct{}
+	intConverter    struct{}
+	floatConverter  struct{}
+	uuidConverter   struct{}
+	pathConverter   struct{}
+	regexpConverter struct{ re *regexp.Regexp }
+)
+
+// AddConverter adds a ConverterFunc used by the converter name in route
+// patterns, e.g. "hex" for :color<hex>, replacing any builtin converter of the
+// same name. Converters are added before the routes using them.
+func (env *Env) AddConverter(name string, fn ConverterFunc) {
+	env.converters[name] = fn
+}
+
+func (env *Env) converter(name, arg string) (Converter, error) {
+	fn, ok := env.converters[name]
+	if !ok {
+		if fn, ok = builtinconverters[name]; !ok {
+			return nil, newError("unknown route converter %q", name)
+		}
+	}
+	return fn(arg)
+}
+
+// parseSegment splits a route path segment into the kind of segment, ':' or
+// '*' for params, the param name or static value, and any converter name &
+// argument, e.g. ":slug<re:[a-z-]+>" as ':', "slug", "re", "[a-z-]+".
+func parseSegment(segment string) (kind byte, value, converter, arg string) {
+	if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+		return 0, segment, "", ""
+	}
+	kind, value = segment[0], segment[1:]
+	if i := strings.Index(value, "<"); i >= 0 && strings.HasSuffix(value, ">") {
+		value, converter = value[:i], value[i+1:len(value)-1]
+		if j := strings.Index(converter, ":"); j >= 0 {
+			converter, arg = converter[:j], converter[j+1:]
+		}
+	}
+	return kind, value, converter, arg
+}
+
+// splitPath splits a route path into its segments at each "/" outside of a
+// converter, so a converter argument, e.g. "*path<re:[a-z]+/[a-z]+>", may
+// contain "/".
+func splitPath(path string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '<':
+			depth++
+		case '>':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				segments = append(segments, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// compile parses the route path into segments with the Converters of the env.
+// A :param matches a single path segment, so its converter argument may not
+// contain "/".
+func (rt *Route) compile(env *Env) {
+	var segments []routeSegment
+	for _, segment := range splitPath(rt.path) {
+		kind, value, name, arg := parseSegment(segment)
+		s := routeSegment{kind: kind, value: value}
+		if kind == ':' && strings.Contains(arg, "/") {
+			panic(newError("[FLOTILLA] route %s: converter of :%s may not contain \"/\"", rt.path, value))
+		}
+		if name != "" {
+			c, err := env.converter(name, arg)
+			if err != nil {
+				panic(newError("[FLOTILLA] route %s: %s", rt.path, err))
+			}
+			s.converter = c
+		}
+		segments = append(segments, s)
+	}
+	rt.segments = segments
+}
+
+// routeSegments returns the compiled route segments, or the segments of a
+// route not yet registered without converters.
+func (rt *Route) routeSegments() []routeSegment {
+	if rt.segments != nil {
+		return rt.segments
+	}
+	return pathSegments(rt.path)
+}
+
+// pathSegments returns the segments of a path without converters.
+func pathSegments(path string) []routeSegment {
+	var segments []routeSegment
+	for _, segment := range splitPath(path) {
+		kind, value, _, _ := parseSegment(segment)
+		segments = append(segments, routeSegment{kind: kind, value: value})
+	}
+	return segments
+}
+
+// enginePath is the route path without converters, as given to the engine.
+func (rt *Route) enginePath() string {
+	segments := rt.routeSegments()
+	path := make([]string, len(segments))
+	for i, s := range segments {
+		if s.kind != 0 {
+			path[i] = string(s.kind) + s.value
+		} else {
+			path[i] = s.value
+		}
+	}
+	return strings.Join(path, "/")
+}
+
+// convert converts the route params of the Ctx with the route converters,
+// returning false where any param does not match its converter.
+func (rt *Route) convert(ctx *Ctx) bool {
+	params := ctx.Params()
+	for _, s := range rt.segments {
+		if s.converter == nil {
+			continue
+		}
+		value, err := s.converter.Convert(params[s.value])
+		if err != nil {
+			return false
+		}
+		if ctx.values == nil {
+			ctx.values = make(map[string]interface{})
+		}
+		ctx.values[s.value] = value
+	}
+	return true
+}
+
+// ParamValue returns the value of the named route parameter as converted by
+// the route converter, e.g. an int for :id<int>, the string value for a
+// parameter without a converter, or nil.
+func (ctx *Ctx) ParamValue(name string) interface{} {
+	if value, ok := ctx.values[name]; ok {
+		return value
+	}
+	if value, ok := ctx.Params()[name]; ok {
+		return value
+	}
+	return nil
+}
+
+// format formats a value with the Converter, by converting its string form.
+func format(c Converter, value interface{}) (string, error) {
+	s := fmt.Sprint(value)
+	if _, err := c.Convert(s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func (stringConverter) Convert(value string) (interface{}, error) {
+	if value == "" || strings.Contains(value, "/") {
+		return nil, newError("%q is not a path segment", value)
+	}
+	return value, nil
+}
+
+func (c stringConverter) Format(value interface{}) (string, error) { return format(c, value) }
+
+func (intConverter) Convert(value string) (interface{}, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, newError("%q is not an integer", value)
+	}
+	return n, nil
+}
+
+func (c intConverter) Format(value interface{}) (string, error) { return format(c, value) }
+
+func (floatConverter) Convert(value string) (interface{}, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, newError("%q is not a number", value)
+	}
+	return n, nil
+}
+
+func (c floatConverter) Format(value interface{}) (string, error) {
+	if n, ok := value.(float64); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+	return format(c, value)
+}
+
+func (uuidConverter) Convert(value string) (interface{}, error) {
+	if !regUUID.MatchString(value) {
+		return nil, newError("%q is not a uuid", value)
+	}
+	return strings.ToLower(value), nil
+}
+
+func (c uuidConverter) Format(value interface{}) (string, error) { return format(c, value) }
+
+func (pathConverter) Convert(value string) (interface{}, error) {
+	if value == "" {
+		return nil, newError("empty path")
+	}
+	return value, nil
+}
+
+func (c pathConverter) Format(value interface{}) (string, error) {
+	if segments, ok := value.([]string); ok {
+		value = strings.Join(segments, "/")
+	}
+	return format(c, value)
+}
+
+func newRegexpConverter(arg string) (Converter, error) {
+	re, err := regexp.Compile(`^(?:` + arg + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	return regexpConverter{re}, nil
+}
+
+func (c regexpConverter) Convert(value string) (interface{}, error) {
+	if !c.re.MatchString(value) {
+		return nil, newError("%q does not match %s", value, c.re)
+	}
+	return value, nil
+}
+
+func (c regexpConverter) Format(value interface{}) (string, error) { return format(c, value) }
@@ -3,8 +3,9 @@ package flotilla
 import (
 	"bytes"
 	"crypto/hmac"
-	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,7 +13,18 @@ import (
 	"time"
 )
 
+const (
+	defaultCookieSalt = "flotilla.cookie"
+
+	// signedCookieMarker prefixes values packed by CookieSigner.Sign, so only
+	// cookies carrying it are verified as signed.
+	signedCookieMarker = "s1|"
+)
+
 var (
+	ErrCookieTampered = newError("cookie signature is not valid")
+	ErrCookieExpired  = newError("cookie signature has expired")
+
 	cNameSanitizer  = strings.NewReplacer("\n", "-", "\r", "-")
 	cValueSanitizer = strings.NewReplacer("\n", " ", "\r", " ", ";", " ")
 )
@@ -31,118 +43,294 @@ func (ctx *Ctx) Cookies() map[string]*http.Cookie {
 	return ret.(map[string]*http.Cookie)
 }
 
-func unpackcookie(ctx *Ctx, cookie *http.Cookie) string {
+func unpackcookie(ctx *Ctx, cookie *http.Cookie) (string, error) {
 	val := cookie.Value
-	if val == "" {
-		return val
+	if !strings.HasPrefix(val, signedCookieMarker) {
+		return val, nil
 	}
+	maxage, _ := ctx.App.Env.Store["COOKIE_SIGNEDMAXAGE"].Int64()
+	return ctx.CookieSigner(defaultCookieSalt).Unsign(cookie.Name, val, maxage)
+}
 
-	parts := strings.SplitN(val, "|", 3)
+// ReadCookies returns a map of cookie values in the request keyed by cookie name,
+// with signed cookies verified & unpacked. Signed cookies that are tampered with
+// or past COOKIE_SIGNEDMAXAGE are not included in the values, but reported in
+// the second map as ErrCookieTampered or ErrCookieExpired.
+func (ctx *Ctx) ReadCookies() (map[string]string, map[string]error) {
+	ret := make(map[string]string)
+	errs := make(map[string]error)
+	cks := cookies(ctx)
+	for k, v := range cks {
+		if val, err := unpackcookie(ctx, v); err != nil {
+			errs[k] = err
+		} else {
+			ret[k] = val
+		}
+	}
+	return ret, errs
+}
 
-	if len(parts) != 3 {
-		return val
+func cookie(ctx *Ctx, secure bool, name string, value string, opts []CookieOption) error {
+	if secure {
+		value = ctx.CookieSigner(defaultCookieSalt).Sign(name, value)
 	}
+	cke := basiccookie(name, value, ctx.cookieOptions(opts))
+	ctx.ModifyHeader("add", []string{"Set-Cookie", cke})
+	return nil
+}
 
-	vs := parts[0]
-	// timestamp := parts[1]
-	sig := parts[2]
+// CookieSigner signs cookie values with a HMAC-SHA256 over cookie name, value
+// and timestamp. The HMAC key is derived from a secret key and a salt, so that
+// values signed for one purpose cannot be used for another. The first of Keys
+// signs, all of Keys are tried when verifying to allow for key rotation.
+type CookieSigner struct {
+	Keys []string
+	Salt string
+}
 
-	if secret, ok := ctx.App.Env.Store["SECRET_KEY"]; ok {
-		h := hmac.New(sha1.New, []byte(secret.Value))
+// CookieSigner returns a CookieSigner for the salt, using the App secret keys.
+func (ctx *Ctx) CookieSigner(salt string) *CookieSigner {
+	return &CookieSigner{Keys: ctx.App.Env.SecretKeys(), Salt: salt}
+}
 
-		if fmt.Sprintf("%02x", h.Sum(nil)) != sig {
-			return ""
-		}
+func (s *CookieSigner) signature(key, name, value, timestamp string) []byte {
+	derived := hmac.New(sha256.New, []byte(key))
+	derived.Write([]byte(s.Salt))
+	h := hmac.New(sha256.New, derived.Sum(nil))
+	fmt.Fprintf(h, "%s|%s|%s", name, value, timestamp)
+	return h.Sum(nil)
+}
 
-		res, _ := base64.URLEncoding.DecodeString(vs)
-		return string(res)
+// Sign returns value packed as "s1|base64 value|timestamp|signature", where the
+// s1 marker identifies a signed value.
+func (s *CookieSigner) Sign(name, value string) string {
+	vs := base64.URLEncoding.EncodeToString([]byte(value))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	var key string
+	if len(s.Keys) > 0 {
+		key = s.Keys[0]
 	}
-	return "cookie value could not be read and/or unpacked"
+	sig := hex.EncodeToString(s.signature(key, name, vs, timestamp))
+	return signedCookieMarker + strings.Join([]string{vs, timestamp, sig}, "|")
 }
 
-func (ctx *Ctx) ReadCookies() map[string]string {
-	ret := make(map[string]string)
-	cks := cookies(ctx)
-	for k, v := range cks {
-		ret[k] = unpackcookie(ctx, v)
+// Unsign verifies & unpacks a value produced by Sign. The signature is compared
+// in constant time against each key. A maxage above zero is the number of
+// seconds after signing the value is accepted.
+func (s *CookieSigner) Unsign(name, signed string, maxage int64) (string, error) {
+	if !strings.HasPrefix(signed, signedCookieMarker) {
+		return "", ErrCookieTampered
 	}
-	return ret
+	parts := strings.SplitN(strings.TrimPrefix(signed, signedCookieMarker), "|", 3)
+	if len(parts) != 3 {
+		return "", ErrCookieTampered
+	}
+	vs, timestamp := parts[0], parts[1]
+	sig, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrCookieTampered
+	}
+	valid := false
+	for _, key := range s.Keys {
+		if hmac.Equal(sig, s.signature(key, name, vs, timestamp)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrCookieTampered
+	}
+	signedat, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrCookieTampered
+	}
+	if maxage > 0 && time.Now().Unix()-signedat > maxage {
+		return "", ErrCookieExpired
+	}
+	res, err := base64.URLEncoding.DecodeString(vs)
+	if err != nil {
+		return "", ErrCookieTampered
+	}
+	return string(res), nil
 }
 
-func cookie(ctx *Ctx, secure bool, name string, value string, opts []interface{}) error {
-	if secure {
-		if secret, ok := ctx.App.Env.Store["SECRET_KEY"]; ok {
-			value = securevalue(secret.Value, value)
+// CookieOptions are the attributes of a cookie set by Ctx.Cookie or
+// Ctx.SecureCookie. A MaxAge of zero omits Max-Age, a negative MaxAge deletes
+// the cookie, as with http.Cookie.
+type CookieOptions struct {
+	MaxAge      int
+	Expires     time.Time
+	Path        string
+	Domain      string
+	Secure      bool
+	HttpOnly    bool
+	SameSite    http.SameSite
+	Priority    string
+	Partitioned bool
+}
+
+// A CookieOption sets a field of CookieOptions.
+type CookieOption func(*CookieOptions)
+
+// CookieMaxAge sets the cookie Max-Age in seconds.
+func CookieMaxAge(seconds int) CookieOption {
+	return func(o *CookieOptions) { o.MaxAge = seconds }
+}
+
+// CookieExpires sets the absolute time the cookie expires.
+func CookieExpires(t time.Time) CookieOption {
+	return func(o *CookieOptions) { o.Expires = t }
+}
+
+// CookiePath sets the cookie Path.
+func CookiePath(path string) CookieOption {
+	return func(o *CookieOptions) { o.Path = path }
+}
+
+// CookieDomain sets the cookie Domain.
+func CookieDomain(domain string) CookieOption {
+	return func(o *CookieOptions) { o.Domain = domain }
+}
+
+// CookieSecure sets whether the cookie is sent only over https.
+func CookieSecure(secure bool) CookieOption {
+	return func(o *CookieOptions) { o.Secure = secure }
+}
+
+// CookieHttpOnly sets whether the cookie is hidden from scripts.
+func CookieHttpOnly(httponly bool) CookieOption {
+	return func(o *CookieOptions) { o.HttpOnly = httponly }
+}
+
+// CookieSameSite sets the cookie SameSite mode.
+func CookieSameSite(mode http.SameSite) CookieOption {
+	return func(o *CookieOptions) { o.SameSite = mode }
+}
+
+// CookiePriority sets the cookie Priority to "Low", "Medium" or "High".
+func CookiePriority(priority string) CookieOption {
+	return func(o *CookieOptions) { o.Priority = priority }
+}
+
+// CookiePartitioned sets the cookie as Partitioned(CHIPS), which also requires
+// the cookie to be Secure.
+func CookiePartitioned(partitioned bool) CookieOption {
+	return func(o *CookieOptions) {
+		o.Partitioned = partitioned
+		if partitioned {
+			o.Secure = true
 		}
 	}
-	cke := basiccookie(name, value, opts...)
-	ctx.ModifyHeader("add", []string{"Set-Cookie", cke})
-	return nil
 }
 
-func securevalue(secret string, value string) string {
-	vs := base64.URLEncoding.EncodeToString([]byte(value))
-	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
-	h := hmac.New(sha1.New, []byte(secret))
-	sig := fmt.Sprintf("%02x", h.Sum(nil))
-	cookie := strings.Join([]string{vs, timestamp, sig}, "|")
-	return cookie
+var sameSiteString = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
 }
 
-func basiccookie(name string, value string, opts ...interface{}) string {
+// CookieDefaults returns app wide cookie options read from the [cookie] section
+// of the Env Store(path, domain, maxage, secure, httponly, samesite, priority,
+// partitioned).
+func (env *Env) CookieDefaults() *CookieOptions {
+	o := &CookieOptions{}
+	if item, ok := env.Store["COOKIE_PATH"]; ok {
+		o.Path = item.Value
+	}
+	if item, ok := env.Store["COOKIE_DOMAIN"]; ok {
+		o.Domain = item.Value
+	}
+	if item, ok := env.Store["COOKIE_MAXAGE"]; ok {
+		o.MaxAge, _ = item.Int()
+	}
+	if item, ok := env.Store["COOKIE_SECURE"]; ok {
+		o.Secure, _ = item.Bool()
+	}
+	if item, ok := env.Store["COOKIE_HTTPONLY"]; ok {
+		o.HttpOnly, _ = item.Bool()
+	}
+	if item, ok := env.Store["COOKIE_SAMESITE"]; ok {
+		o.SameSite = sameSiteString[strings.ToLower(item.Value)]
+	}
+	if item, ok := env.Store["COOKIE_PRIORITY"]; ok {
+		o.Priority = item.Value
+	}
+	if item, ok := env.Store["COOKIE_PARTITIONED"]; ok {
+		partitioned, _ := item.Bool()
+		CookiePartitioned(partitioned)(o)
+	}
+	return o
+}
+
+func (ctx *Ctx) cookieOptions(opts []CookieOption) *CookieOptions {
+	o := ctx.App.Env.CookieDefaults()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func basiccookie(name string, value string, o *CookieOptions) string {
 	var b bytes.Buffer
 	fmt.Fprintf(&b,
 		"%s=%s",
 		cNameSanitizer.Replace(name),
 		cValueSanitizer.Replace(value))
-	if len(opts) > 0 {
-		if opt, ok := opts[0].(int); ok {
-			if opt > 0 {
-				fmt.Fprintf(&b, "; Max-Age=%d", opt)
-			} else {
-				fmt.Fprintf(&b, "; Max-Age=0")
-			}
-		}
+	if o.MaxAge > 0 {
+		fmt.Fprintf(&b, "; Max-Age=%d", o.MaxAge)
+	} else if o.MaxAge < 0 {
+		fmt.Fprintf(&b, "; Max-Age=0")
 	}
-	if len(opts) > 1 {
-		if opt, ok := opts[1].(string); ok && len(opt) > 0 {
-			fmt.Fprintf(&b, "; Path=%s", cValueSanitizer.Replace(opt))
-		}
+	if !o.Expires.IsZero() {
+		fmt.Fprintf(&b, "; Expires=%s", o.Expires.UTC().Format(http.TimeFormat))
 	}
-	if len(opts) > 2 {
-		if opt, ok := opts[2].(string); ok && len(opt) > 0 {
-			fmt.Fprintf(&b, "; Domain=%s", cValueSanitizer.Replace(opt))
-		}
+	if len(o.Path) > 0 {
+		fmt.Fprintf(&b, "; Path=%s", cValueSanitizer.Replace(o.Path))
 	}
-	secure := false
-	if len(opts) > 3 {
-		if opt, ok := opts[3].(bool); ok {
-			secure = opt
-		}
+	if len(o.Domain) > 0 {
+		fmt.Fprintf(&b, "; Domain=%s", cValueSanitizer.Replace(o.Domain))
 	}
-	if secure {
+	if o.Secure {
 		fmt.Fprintf(&b, "; Secure")
 	}
-	httponly := false
-	if len(opts) > 4 {
-		if opt, ok := opts[4].(bool); ok {
-			httponly = opt
-		}
-	}
-	if httponly {
+	if o.HttpOnly {
 		fmt.Fprintf(&b, "; HttpOnly")
 	}
+	switch o.SameSite {
+	case http.SameSiteLaxMode:
+		fmt.Fprintf(&b, "; SameSite=Lax")
+	case http.SameSiteStrictMode:
+		fmt.Fprintf(&b, "; SameSite=Strict")
+	case http.SameSiteNoneMode:
+		fmt.Fprintf(&b, "; SameSite=None")
+	}
+	if len(o.Priority) > 0 {
+		fmt.Fprintf(&b, "; Priority=%s", cValueSanitizer.Replace(o.Priority))
+	}
+	if o.Partitioned {
+		fmt.Fprintf(&b, "; Partitioned")
+	}
 	return b.String()
 }
 
-func (ctx *Ctx) SecureCookie(name string, value string, opts ...interface{}) error {
+// SecureCookie adds a cookie to the header like Cookie, with the value signed
+// by the App secret key.
+func (ctx *Ctx) SecureCookie(name string, value string, opts ...CookieOption) error {
 	_, err := ctx.Call("cookie", ctx, true, name, value, opts)
 	return err
 }
 
-// Cookie takes a name, value and optional options(MaxAge as int, Path & Domain
-// as string, Secure & as bool) to add a cookie to the header.
-func (ctx *Ctx) Cookie(name string, value string, opts ...interface{}) error {
+// Cookie takes a name, value and any CookieOption, applied over the App cookie
+// defaults, to add a cookie to the header.
+func (ctx *Ctx) Cookie(name string, value string, opts ...CookieOption) error {
 	_, err := ctx.Call("cookie", ctx, false, name, value, opts)
 	return err
 }
+
+// DeleteCookie adds an expired, empty cookie to the header, removing the named
+// cookie from the client. Path and Domain must match those the cookie was set
+// with.
+func (ctx *Ctx) DeleteCookie(name string, opts ...CookieOption) error {
+	opts = append(opts, CookieMaxAge(-1), CookieExpires(time.Unix(0, 0)))
+	return ctx.Cookie(name, "", opts...)
+}
@@ -26,7 +26,9 @@ type (
 
 	// The Current interface handles the information boundary between incoming
 	// engine context and flotilla context. The engine must provide a context.Context
-	// with a Value fitting this interface.
+	// with a Value fitting this interface, and may supply route parameters by
+	// also fitting the ParamsCurrent interface, sparing Ctx.Params a second
+	// match of the request path.
 	Current interface {
 		Request() *http.Request
 		Data() map[string]interface{}
@@ -49,6 +51,11 @@ type (
 		funcs      map[string]reflect.Value
 		processors map[string]reflect.Value
 		statusfunc func(int)
+		route      *Route
+		current    Current
+		errors     errorMsgs
+		params     map[string]string
+		values     map[string]interface{}
 		Request    *http.Request
 		Session    session.SessionStore
 		Data       map[string]interface{}
@@ -68,8 +75,9 @@ func (a *App) tmpCtx(w ResponseWriter, req *http.Request) *Ctx {
 	return ctx
 }
 
-func (rt Route) newCtx() interface{} {
+func (rt *Route) newCtx() interface{} {
 	return &Ctx{index: -1,
+		route:      rt,
 		handlers:   rt.handlers,
 		App:        rt.App(),
 		Data:       make(map[string]interface{}),
@@ -78,38 +86,193 @@ func (rt Route) newCtx() interface{} {
 	}
 }
 
-func (rt Route) getCtx(c Current) *Ctx {
+func (rt *Route) getCtx(c Current) *Ctx {
 	ctx := rt.p.Get().(*Ctx)
+	ctx.current = c
 	ctx.Request = c.Request()
 	ctx.rw = c.Writer()
 	ctx.Data = c.Data()
 	if sf, exists := c.StatusFunc(); exists {
 		ctx.statusfunc = sf
 	}
-	ctx.Start()
+	if rt.sessionless {
+		ctx.Session = disabledSession{}
+	} else {
+		ctx.Start()
+	}
 	return ctx
 }
 
-func (rt Route) putCtx(ctx *Ctx) {
+func (rt *Route) putCtx(ctx *Ctx) {
 	ctx.index = -1
 	ctx.Session = nil
 	for k, _ := range ctx.Data {
 		delete(ctx.Data, k)
 	}
 	ctx.deferred = nil
+	ctx.errors = nil
+	ctx.current = nil
+	ctx.params = nil
+	ctx.values = nil
 	rt.p.Put(ctx)
 }
 
+// A *Ctx for use outside of a request, e.g. rendering templates, with a
+// synthetic GET request for "/", no Session, and no ResponseWriter.
+func (a *App) syntheticCtx() *Ctx {
+	req, _ := http.NewRequest("GET", "/", nil)
+	return &Ctx{App: a,
+		Request:    req,
+		Data:       make(map[string]interface{}),
+		funcs:      reflectFuncs(a.ctxfunctions),
+		processors: reflectFuncs(a.ctxprocessors),
+	}
+}
+
+// Error records an error internal to the request, with any meta data useful
+// to status handlers, e.g. the name of a template failing to render. Errors
+// are also kept in Ctx.Data as "Errors", for status handlers & templates.
+func (ctx *Ctx) Error(err error, meta interface{}) {
+	ctx.errors = append(ctx.errors, errorMsg{Err: err.Error(), Type: ErrorTypeInternal, Meta: meta})
+	if ctx.Data != nil {
+		ctx.Data["Errors"] = ctx.errors
+	}
+}
+
+// Errors returns the errors recorded with the Ctx.
+func (ctx *Ctx) Errors() errorMsgs {
+	return ctx.errors
+}
+
+// Start sets a lazy Session, started by the SessionManager on first use.
 func (ctx *Ctx) Start() {
-	ctx.Session = ctx.App.SessionManager.SessionStart(ctx.rw, ctx.Request)
+	ctx.Session = &lazySession{ctx: ctx}
 }
 
+// Release writes the Session to the response, if it was modified or must be
+// re-issued. A Session is released once, before the response is written, so
+// later changes return ErrSessionReleased.
 func (ctx *Ctx) Release() {
-	if !ctx.rw.Written() {
+	if s, ok := ctx.Session.(*lazySession); ok {
+		s.released = true
+	}
+	if ctx.Session != nil && !ctx.rw.Written() {
 		ctx.Session.SessionRelease(ctx.rw)
 	}
 }
 
+// RegenerateSession replaces the session id, keeping the session data. The
+// old id is invalidated by server-side session providers, so handlers changing
+// privileges(e.g. login) can defend against session fixation.
+func (ctx *Ctx) RegenerateSession() {
+	switch s := ctx.Session.(type) {
+	case nil, disabledSession:
+	case *lazySession:
+		s.store = ctx.App.SessionManager.SessionRegenerate(ctx.rw, ctx.Request, s.start())
+		s.modified = true
+	default:
+		ctx.Session = ctx.App.SessionManager.SessionRegenerate(ctx.rw, ctx.Request, s)
+	}
+}
+
+// ErrSessionReleased is returned by the Session of a Ctx for any change made
+// once the Session has been released or the response written, which would be
+// lost.
+var ErrSessionReleased = newError("session changed after it was released with the response")
+
+// lazySession is the session.SessionStore of a Ctx, starting the session only
+// when first used and releasing it only when modified, so requests that never
+// touch the session do no session work and set no session cookie. A cookie
+// session that was read is released too, re-issuing the cookie so it does
+// not expire while in use.
+type lazySession struct {
+	ctx      *Ctx
+	store    session.SessionStore
+	modified bool
+	released bool
+}
+
+// change marks the session modified, or returns ErrSessionReleased where the
+// change would be lost.
+func (s *lazySession) change() error {
+	if s.released || (s.ctx.rw != nil && s.ctx.rw.Written()) {
+		return ErrSessionReleased
+	}
+	s.modified = true
+	return nil
+}
+
+func (s *lazySession) start() session.SessionStore {
+	if s.store == nil {
+		s.store = s.ctx.App.SessionManager.SessionStart(s.ctx.rw, s.ctx.Request)
+	}
+	return s.store
+}
+
+func (s *lazySession) Set(key, value interface{}) error {
+	if err := s.change(); err != nil {
+		return err
+	}
+	return s.start().Set(key, value)
+}
+
+// Get does not start a session for a request without a session cookie, as
+// there is nothing to read.
+func (s *lazySession) Get(key interface{}) interface{} {
+	if s.store == nil && !s.ctx.App.SessionManager.HasSession(s.ctx.Request) {
+		return nil
+	}
+	return s.start().Get(key)
+}
+
+func (s *lazySession) Delete(key interface{}) error {
+	if err := s.change(); err != nil {
+		return err
+	}
+	return s.start().Delete(key)
+}
+
+func (s *lazySession) SessionID() string {
+	return s.start().SessionID()
+}
+
+func (s *lazySession) SessionRelease(w http.ResponseWriter) {
+	if s.store == nil {
+		return
+	}
+	if _, cookie := s.store.(*session.CookieSessionStore); s.modified || cookie {
+		s.store.SessionRelease(w)
+	}
+}
+
+func (s *lazySession) Flush() error {
+	if err := s.change(); err != nil {
+		return err
+	}
+	return s.start().Flush()
+}
+
+// ErrSessionDisabled is returned by the Session of a route with sessions
+// disabled for any change to the session.
+var ErrSessionDisabled = newError("sessions are disabled for the route")
+
+// disabledSession is the session.SessionStore of a Ctx for a route with
+// sessions disabled. It holds nothing and refuses changes, so handlers shared
+// with routes using sessions need not check for a Session.
+type disabledSession struct{}
+
+func (disabledSession) Set(key, value interface{}) error { return ErrSessionDisabled }
+
+func (disabledSession) Get(key interface{}) interface{} { return nil }
+
+func (disabledSession) Delete(key interface{}) error { return ErrSessionDisabled }
+
+func (disabledSession) SessionID() string { return "" }
+
+func (disabledSession) SessionRelease(w http.ResponseWriter) {}
+
+func (disabledSession) Flush() error { return ErrSessionDisabled }
+
 // Calls a function with name in *Ctx.funcs passing in the given args.
 func (ctx *Ctx) Call(name string, args ...interface{}) (interface{}, error) {
 	return call(ctx.funcs[name], args...)
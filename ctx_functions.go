@@ -1,20 +1,38 @@
 package flotilla
 
-import "net/http"
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
 
 var (
 	builtinctxfuncs = map[string]interface{}{
 		"abort":            defaultabort,
 		"allflashmessages": allflashmessages,
+		"bind":             bind,
+		"buildurl":         buildurl,
 		"cookie":           cookie,
 		"cookies":          cookies,
 		"flash":            flash,
 		"flashmessages":    flashmessages,
+		"paramerror":       paramerror,
 		"redirect":         redirect,
 		"rendertemplate":   rendertemplate,
 		"serveplain":       serveplain,
 		"servefile":        servefile,
+		"servejson":        servejson,
+		"servejsonp":       servejsonp,
+		"servexml":         servexml,
+		"staticurl":        staticurl,
 		"urlfor":           urlfor,
+		"validate":         validate,
+		"validationerrors": validationerrors,
 	}
 )
 
@@ -76,9 +94,103 @@ func (ctx *Ctx) ServePlain(code int, data []byte) {
 	ctx.Call("serveplain", ctx, code, data)
 }
 
+var regJSONPCallback = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
+
+// serveencoded writes encoded data with the status code, and the content type
+// where the response has none set by a handler.
+func serveencoded(ctx *Ctx, code int, contenttype string, data []byte) {
+	ctx.Push(func(c *Ctx) {
+		if c.rw.Header().Get("Content-Type") == "" {
+			c.rw.Header().Set("Content-Type", contenttype)
+		}
+		c.rw.WriteHeader(code)
+		c.rw.Write(data)
+	})
+}
+
+// encodingerror records an error encoding a response, responded to with the
+// status code.
+func encodingerror(ctx *Ctx, code int, err error, format string) error {
+	ctx.Error(err, format)
+	ctx.Push(func(c *Ctx) { c.Status(code) })
+	return err
+}
+
+func marshaljson(ctx *Ctx, data interface{}) ([]byte, error) {
+	if ctx.App.Mode.Development {
+		return json.MarshalIndent(data, "", "  ")
+	}
+	return json.Marshal(data)
+}
+
+func servejson(ctx *Ctx, code int, data interface{}) error {
+	b, err := marshaljson(ctx, data)
+	if err != nil {
+		return encodingerror(ctx, 500, err, "json")
+	}
+	serveencoded(ctx, code, "application/json; charset=utf-8", b)
+	return nil
+}
+
+// ServeJSON writes data encoded as JSON, indented in development mode, with
+// the HTTP code, using the Ctx servejson function.
+func (ctx *Ctx) ServeJSON(code int, data interface{}) {
+	ctx.Call("servejson", ctx, code, data)
+}
+
+func servejsonp(ctx *Ctx, code int, callback string, data interface{}) error {
+	if callback == "" {
+		callback = ctx.Request.URL.Query().Get("callback")
+	}
+	if !regJSONPCallback.MatchString(callback) {
+		return encodingerror(ctx, 400, newError("invalid JSONP callback %q", callback), "jsonp")
+	}
+	b, err := marshaljson(ctx, data)
+	if err != nil {
+		return encodingerror(ctx, 500, err, "jsonp")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "/**/ %s(%s);", callback, b)
+	serveencoded(ctx, code, "application/javascript; charset=utf-8", buf.Bytes())
+	return nil
+}
+
+// ServeJSONP writes data encoded as JSON, wrapped in a call to the callback
+// or, if empty, the callback named by the "callback" query parameter, using
+// the Ctx servejsonp function.
+func (ctx *Ctx) ServeJSONP(code int, callback string, data interface{}) {
+	ctx.Call("servejsonp", ctx, code, callback, data)
+}
+
+func servexml(ctx *Ctx, code int, data interface{}) error {
+	var b []byte
+	var err error
+	if ctx.App.Mode.Development {
+		b, err = xml.MarshalIndent(data, "", "  ")
+	} else {
+		b, err = xml.Marshal(data)
+	}
+	if err != nil {
+		return encodingerror(ctx, 500, err, "xml")
+	}
+	serveencoded(ctx, code, "application/xml; charset=utf-8", append([]byte(xml.Header), b...))
+	return nil
+}
+
+// ServeXML writes data encoded as XML, indented in development mode, with the
+// HTTP code, using the Ctx servexml function.
+func (ctx *Ctx) ServeXML(code int, data interface{}) {
+	ctx.Call("servexml", ctx, code, data)
+}
+
 func servefile(ctx *Ctx, f http.File) error {
 	fi, err := f.Stat()
 	if err == nil {
+		if ctx.rw.Header().Get("Etag") == "" && !fi.IsDir() {
+			if etag, err := fileETag(f, fi); err == nil {
+				ctx.rw.Header().Set("Etag", etag)
+			}
+		}
 		http.ServeContent(ctx.rw, ctx.Request, fi.Name(), fi.ModTime(), f)
 	}
 	return err
@@ -89,20 +201,66 @@ func (ctx *Ctx) ServeFile(f http.File) {
 	ctx.Call("servefile", ctx, f)
 }
 
+func staticurl(ctx *Ctx, requested string) (string, error) {
+	return ctx.App.StaticUrl(requested)
+}
+
+// StaticUrl provides a fingerprinted url for the requested static file, using
+// the Ctx staticurl function.
+func (ctx *Ctx) StaticUrl(requested string) string {
+	ret, err := ctx.Call("staticurl", ctx, requested)
+	if err != nil {
+		return err.Error()
+	}
+	return ret.(string)
+}
+
 func rendertemplate(ctx *Ctx, name string, data interface{}) error {
 	td := TemplateData(ctx, data)
 	ctx.Push(func(c *Ctx) {
-		c.App.Templator.Render(c.rw, name, td)
+		b, err := c.App.render(name, td)
+		if err != nil {
+			c.Error(err, name)
+			c.Status(500)
+			return
+		}
+		c.rw.Write(b)
 	})
 	return nil
 }
 
 // RenderTemplate renders an HTML template response with the Ctx rendertemplate
-// function.
+// function. A template failing to render is recorded as a Ctx error, and
+// responded to with a 500 status.
 func (ctx *Ctx) RenderTemplate(name string, data interface{}) {
 	ctx.Call("rendertemplate", ctx, name, data)
 }
 
+// RenderToString returns the named template rendered with TemplateData for the
+// Ctx and data, without writing a response, e.g. for a partial response or an
+// email.
+func (ctx *Ctx) RenderToString(name string, data interface{}) (string, error) {
+	b, err := ctx.App.render(name, TemplateData(ctx, data))
+	return string(b), err
+}
+
+// RenderTemplate returns the named template rendered outside of a request,
+// with TemplateData for a synthetic Ctx and data.
+func (app *App) RenderTemplate(name string, data interface{}) ([]byte, error) {
+	return app.render(name, TemplateData(app.syntheticCtx(), data))
+}
+
+func (app *App) render(name string, td TData) ([]byte, error) {
+	if app.Templator == nil {
+		return nil, newError("no Templator to render %s", name)
+	}
+	var b bytes.Buffer
+	if err := app.Templator.Render(&b, name, td); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 func urlfor(ctx *Ctx, route string, external bool, params []string) (string, error) {
 	if route, ok := ctx.App.Routes()[route]; ok {
 		routeurl, _ := route.Url(params...)
@@ -136,60 +294,197 @@ func (ctx *Ctx) UrlExternal(route string, params ...string) string {
 	return ret.(string)
 }
 
-func flash(ctx *Ctx, category string, message string) error {
-	if fl := ctx.Session.Get("_flashes"); fl != nil {
-		if fls, ok := fl.(map[string]string); ok {
-			fls[category] = message
-			ctx.Session.Set("_flashes", fls)
+// urlParams returns url params from a single map, e.g. map[string]interface{}
+// or url.Values, or from key value pairs, e.g. "id", 7, "_anchor", "top".
+func urlParams(params ...interface{}) (map[string]interface{}, error) {
+	p := make(map[string]interface{})
+	if len(params) == 1 {
+		switch m := params[0].(type) {
+		case map[string]interface{}:
+			for k, v := range m {
+				p[k] = v
+			}
+			return p, nil
+		case map[string]string:
+			for k, v := range m {
+				p[k] = v
+			}
+			return p, nil
+		case url.Values:
+			for k, v := range m {
+				p[k] = v
+			}
+			return p, nil
 		}
-	} else {
-		fl := make(map[string]string)
-		fl[category] = message
-		ctx.Session.Set("_flashes", fl)
 	}
-	return nil
+	if len(params)%2 != 0 {
+		return nil, newError("url params must be a map or key value pairs, not %v", params)
+	}
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return nil, newError("url param key %v is not a string", params[i])
+		}
+		p[key] = params[i+1]
+	}
+	return p, nil
 }
 
-// Flash sets a flash message in the session with a category and a message.
-func (ctx *Ctx) Flash(category string, message string) {
-	ctx.Call("flash", ctx, category, message)
-}
-
-func flashmessages(ctx *Ctx, categories []string) []string {
-	var ret []string
-	if fl := ctx.Session.Get("_flashes"); fl != nil {
-		if fls, ok := fl.(map[string]string); ok {
-			for k, v := range fls {
-				if existsIn(k, categories) {
-					ret = append(ret, v)
-					delete(fls, k)
-				}
+// urlOption returns an option of buildurl as a string, from a string, the
+// first of a []string as in url.Values, or any other value.
+func urlOption(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// buildurl builds the url of the named route from params, where the options
+// _anchor, _scheme & _external are removed from params and set the url
+// fragment, scheme, and host of the request. A _scheme is an external url.
+// Options may be strings, as from url.Values or map[string]string, with
+// _external any value parsed by strconv.ParseBool.
+func buildurl(ctx *Ctx, route string, params map[string]interface{}) (string, error) {
+	rt, ok := ctx.App.Routes()[route]
+	if !ok {
+		return "", newError("no route named %s", route)
+	}
+	options := make(map[string]interface{})
+	for _, option := range []string{"_anchor", "_scheme", "_external"} {
+		if value, ok := params[option]; ok {
+			options[option] = value
+			delete(params, option)
+		}
+	}
+	u, err := rt.UrlParams(params)
+	if err != nil {
+		return "", err
+	}
+	if anchor, ok := options["_anchor"]; ok {
+		u.Fragment = urlOption(anchor)
+	}
+	scheme := urlOption(options["_scheme"])
+	external, ok := options["_external"].(bool)
+	if value, exists := options["_external"]; exists && !ok {
+		if external, err = strconv.ParseBool(urlOption(value)); err != nil {
+			return "", newError("url option _external %v is not a boolean", value)
+		}
+	}
+	if external || scheme != "" {
+		if scheme == "" {
+			scheme = "http"
+			if ctx.Request.TLS != nil {
+				scheme = "https"
 			}
-			ctx.Session.Set("_flashes", fls)
 		}
+		u.Scheme, u.Host = scheme, ctx.Request.Host
 	}
-	return ret
+	return u.String(), nil
 }
 
-// FlashMessages gets flash messages set in the session by provided categories.
-func (ctx *Ctx) FlashMessages(categories ...string) []string {
-	ret, _ := ctx.Call("flashmessages", ctx, categories)
-	return ret.([]string)
+// UrlFor provides the url of the named route, from params given as a single
+// map or as key value pairs, using the Ctx buildurl function, e.g.
+//
+// 	ctx.UrlFor("user", "id", 7, "tab", "posts", "_anchor", "top")
+//
+// for a route "/user/:id<int>" named "user" as "/user/7?tab=posts#top". Path
+// params are matched by name, and any other params are encoded as the query
+// string. The _external option provides a full url with the host & scheme
+// of the request, and _scheme a full url with the given scheme. An error is
+// returned for a route without all of its path params.
+func (ctx *Ctx) UrlFor(route string, params ...interface{}) (string, error) {
+	p, err := urlParams(params...)
+	if err != nil {
+		return "", err
+	}
+	ret, err := ctx.Call("buildurl", ctx, route, p)
+	if err != nil {
+		return "", err
+	}
+	return ret.(string), nil
+}
+
+// UrlFor provides the url of the named route outside of a request as
+// Ctx.UrlFor, with a synthetic Ctx for a request to "/" without a host.
+func (app *App) UrlFor(route string, params ...interface{}) (string, error) {
+	return app.syntheticCtx().UrlFor(route, params...)
+}
+
+func sessionflashes(ctx *Ctx) Flashes {
+	if fl, ok := ctx.Session.Get("_flashes").(Flashes); ok {
+		return fl
+	}
+	return nil
+}
+
+func flash(ctx *Ctx, category string, message string, data map[string]interface{}) error {
+	if ctx.Session == nil {
+		return newError("flash messages require a session")
+	}
+	fls := sessionflashes(ctx)
+	fls = append(fls[:len(fls):len(fls)], FlashMessage{category, message, data})
+	return ctx.Session.Set("_flashes", fls)
 }
 
-func allflashmessages(ctx *Ctx) map[string]string {
-	var ret map[string]string
-	if fl := ctx.Session.Get("_flashes"); fl != nil {
-		if fls, ok := fl.(map[string]string); ok {
-			ret = fls
+// Flash sets a flash message in the session with a category and a message.
+// Messages of the same category are kept in the order they are set.
+func (ctx *Ctx) Flash(category string, message string) {
+	ctx.Call("flash", ctx, category, message, map[string]interface{}(nil))
+}
+
+// FlashData sets a flash message in the session with a category, a message and
+// structured data.
+func (ctx *Ctx) FlashData(category string, message string, data map[string]interface{}) {
+	ctx.Call("flash", ctx, category, message, data)
+}
+
+func flashmessages(ctx *Ctx, categories []string, consume bool) Flashes {
+	if ctx.Session == nil {
+		return nil
+	}
+	fls := sessionflashes(ctx)
+	if len(fls) == 0 {
+		return nil
+	}
+	matched, rest := fls.split(categories)
+	if consume && len(matched) > 0 {
+		if len(rest) > 0 {
+			ctx.Session.Set("_flashes", rest)
+		} else {
+			ctx.Session.Delete("_flashes")
 		}
 	}
-	ctx.Session.Delete("_flashes")
-	return ret
+	return matched
+}
+
+// FlashMessages gets & consumes flash messages set in the session in any of the
+// provided categories, or all categories if none are provided.
+func (ctx *Ctx) FlashMessages(categories ...string) Flashes {
+	ret, _ := ctx.Call("flashmessages", ctx, categories, true)
+	return ret.(Flashes)
+}
+
+// PeekFlashMessages gets flash messages set in the session as FlashMessages,
+// without consuming them.
+func (ctx *Ctx) PeekFlashMessages(categories ...string) Flashes {
+	ret, _ := ctx.Call("flashmessages", ctx, categories, false)
+	return ret.(Flashes)
+}
+
+func allflashmessages(ctx *Ctx) Flashes {
+	return flashmessages(ctx, nil, true)
 }
 
-// AllFlashMessages gets all flash messages set in the session.
-func (ctx *Ctx) AllFlashMessages() map[string]string {
+// AllFlashMessages gets & consumes all flash messages set in the session.
+func (ctx *Ctx) AllFlashMessages() Flashes {
 	ret, _ := ctx.Call("allflashmessages", ctx)
-	return ret.(map[string]string)
+	return ret.(Flashes)
 }
@@ -19,6 +19,20 @@ type (
 		Reconfigure(func() error) error
 		ServeHTTP(http.ResponseWriter, *http.Request)
 	}
+
+	// defaultengine is the default engine, giving its route handlers a
+	// Current fitting ParamsCurrent.
+	defaultengine struct {
+		*engine.Engine
+	}
+
+	// defaultCurrent is the Current of the default engine, with the :param &
+	// *splat values of the engine path its route was taken with.
+	defaultCurrent struct {
+		Current
+		pattern []routeSegment
+		params  map[string]string
+	}
 )
 
 func DefaultEngine(a *App) error {
@@ -27,17 +41,40 @@ func DefaultEngine(a *App) error {
 	return nil
 }
 
-func defaultEngine() *engine.Engine {
+func defaultEngine() *defaultengine {
 	e, err := engine.New(engine.HTMLStatus(true))
 	if err != nil {
 		panic(fmt.Sprintf("[FLOTILLA] engine could not be created properly: %s", err))
 	}
-	return e
+	return &defaultengine{e}
+}
+
+// Take registers the handler with the engine, wrapping the engine Current in
+// a defaultCurrent for the path.
+func (e *defaultengine) Take(path string, method string, handler func(context.Context)) {
+	pattern := pathSegments(path)
+	e.Engine.Take(path, method, func(c context.Context) {
+		if current, ok := c.Value("Current").(Current); ok {
+			if _, ok := current.(ParamsCurrent); !ok {
+				c = context.WithValue(c, "Current", &defaultCurrent{Current: current, pattern: pattern})
+			}
+		}
+		handler(c)
+	})
+}
+
+// Params returns the :param & *splat values of the request path, matched once
+// against the engine path.
+func (c *defaultCurrent) Params() map[string]string {
+	if c.params == nil {
+		c.params, _ = matchSegments(c.pattern, c.Request().URL.Path)
+	}
+	return c.params
 }
 
 func reconfigureDefault(a *App) error {
 	re := func() error {
-		e := a.Engine.(*engine.Engine)
+		e := a.Engine.(*defaultengine).Engine
 		var cnf []engine.Conf
 		if mm, err := a.Env.Store["UPLOAD_SIZE"].Int64(); err == nil {
 			cnf = append(cnf, engine.MaxFormMemory(mm))
@@ -1,10 +1,13 @@
 package flotilla
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 
 	"github.com/thrisp/flotilla/session"
 )
@@ -32,16 +35,24 @@ type (
 		Assets
 		Staticor
 		Templator
-		ctxfunctions map[string]interface{}
-		tplfunctions map[string]interface{}
+		ctxfunctions  map[string]interface{}
+		tplfunctions  map[string]interface{}
+		tplnamespaces map[string]Assets
+		validators    map[string]ValidatorFunc
+		converters    map[string]ConverterFunc
 	}
 )
 
 func (e *Env) defaults() {
 	e.Store.addDefault("upload", "size", "10000000")             // bytes
 	e.Store.addDefault("secret", "key", "Flotilla;Secret;Key;1") // weak default value
+	e.Store.addDefault("param", "status", "404")
 	e.Store.addDefault("session", "cookiename", "session")
 	e.Store.addDefault("session", "lifetime", "2629743")
+	e.Store.addDefault("session", "provider", "cookie")
+	e.Store.addDefault("session", "cipher", "gcm")
+	e.Store.addDefault("session", "serializer", "gob")
+	e.Store.addDefault("session", "path", filepath.Join(workingPath, "sessions"))
 	e.Store.add("static", "directories", workingStatic)
 	e.Store.add("template", "directories", workingTemplates)
 }
@@ -49,9 +60,12 @@ func (e *Env) defaults() {
 // EmptyEnv produces an Env with intialization but no configuration.
 func EmptyEnv() *Env {
 	return &Env{Mode: &Modes{true, false, false},
-		Store:        make(Store),
-		ctxfunctions: make(map[string]interface{}),
-		tplfunctions: make(map[string]interface{}),
+		Store:         make(Store),
+		ctxfunctions:  make(map[string]interface{}),
+		tplfunctions:  make(map[string]interface{}),
+		tplnamespaces: make(map[string]Assets),
+		validators:    make(map[string]ValidatorFunc),
+		converters:    make(map[string]ConverterFunc),
 	}
 }
 
@@ -61,11 +75,24 @@ func (env *Env) BaseEnv() {
 	env.defaults()
 }
 
+// AddAssets adds any number of fs.FS, e.g. an embed.FS or AssetFS.FS(), to the
+// Env Assets.
+func (env *Env) AddAssets(fsys ...fs.FS) {
+	env.Assets = append(env.Assets, fsys...)
+}
+
 // Merges an outside env instance with the calling Env.
 func (env *Env) MergeEnv(other *Env) {
 	env.MergeStore(other.Store)
-	for _, fs := range other.Assets {
-		env.Assets = append(env.Assets, fs)
+	env.AddAssets(other.Assets...)
+	for namespace, fsys := range other.tplnamespaces {
+		env.AddTemplateNamespace(namespace, fsys...)
+	}
+	for name, fn := range other.validators {
+		env.AddValidator(name, fn)
+	}
+	for name, fn := range other.converters {
+		env.AddConverter(name, fn)
 	}
 	env.StaticDirs(other.Store["STATIC_DIRECTORIES"].List()...)
 	env.TemplateDirs(other.Store["TEMPLATE_DIRECTORIES"].List()...)
@@ -129,16 +156,80 @@ func (env *Env) AddTplFuncs(fns map[string]interface{}) {
 	}
 }
 
-func (env *Env) defaultsessionconfig() string {
+// SecretKeys returns the key ring of SECRET_KEY followed by any previous keys
+// listed in SECRET_FALLBACKS, e.g. [secret] fallbacks = oldkey,olderkey
+func (env *Env) SecretKeys() []string {
+	var keys []string
+	if secret, ok := env.Store["SECRET_KEY"]; ok {
+		keys = append(keys, secret.Value)
+	}
+	if fallbacks, ok := env.Store["SECRET_FALLBACKS"]; ok {
+		for _, k := range fallbacks.List() {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = doAdd(k, keys)
+			}
+		}
+	}
+	return keys
+}
+
+func (env *Env) defaultsessionconfig(provider string) string {
 	secret := env.Store["SECRET_KEY"].Value
 	cookie_name := env.Store["SESSION_COOKIENAME"].Value
 	session_lifetime, _ := env.Store["SESSION_LIFETIME"].Int64()
-	prvdrcfg := fmt.Sprintf(`"ProviderConfig":"{\"maxage\": %d,\"cookieName\":\"%s\",\"securityKey\":\"%s\"}"`, session_lifetime, cookie_name, secret)
-	return fmt.Sprintf(`{"cookieName":"%s","enableSetCookie":false,"gclifetime":3600, %s}`, cookie_name, prvdrcfg)
+	switch provider {
+	case "cookie":
+		// [session] legacy, to read cookies of the ctr cipher while migrating
+		legacy, _ := env.storeValue("SESSION_LEGACY").Bool()
+		cookiecfg, _ := json.Marshal(map[string]interface{}{
+			"maxage":      session_lifetime,
+			"cookieName":  cookie_name,
+			"securityKey": secret,
+			"keys":        env.SecretKeys(),
+			"cipher":      env.Store["SESSION_CIPHER"].Value,
+			"serializer":  env.Store["SESSION_SERIALIZER"].Value,
+			"legacy":      legacy,
+		})
+		prvdrcfg, _ := json.Marshal(string(cookiecfg))
+		return fmt.Sprintf(`{"cookieName":"%s","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":%s}`, cookie_name, prvdrcfg)
+	case "file":
+		path, _ := json.Marshal(map[string]string{
+			"path":       env.Store["SESSION_PATH"].Value,
+			"serializer": env.Store["SESSION_SERIALIZER"].Value,
+		})
+		prvdrcfg, _ := json.Marshal(string(path))
+		return fmt.Sprintf(`{"cookieName":"%s","gclifetime":3600,"maxLifetime":%d,"cookieLifeTime":%d,"ProviderConfig":%s}`, cookie_name, session_lifetime, session_lifetime, prvdrcfg)
+	case "sql":
+		// [session] driver & dsn, with any dialect & createschema
+		createschema, _ := env.storeValue("SESSION_CREATESCHEMA").Bool()
+		sqlcfg, _ := json.Marshal(map[string]interface{}{
+			"driver":       env.storeValue("SESSION_DRIVER").Value,
+			"dsn":          env.storeValue("SESSION_DSN").Value,
+			"dialect":      env.storeValue("SESSION_DIALECT").Value,
+			"createSchema": createschema,
+			"serializer":   env.Store["SESSION_SERIALIZER"].Value,
+		})
+		prvdrcfg, _ := json.Marshal(string(sqlcfg))
+		return fmt.Sprintf(`{"cookieName":"%s","gclifetime":3600,"maxLifetime":%d,"cookieLifeTime":%d,"ProviderConfig":%s}`, cookie_name, session_lifetime, session_lifetime, prvdrcfg)
+	}
+	return fmt.Sprintf(`{"cookieName":"%s","gclifetime":3600,"maxLifetime":%d,"cookieLifeTime":%d}`, cookie_name, session_lifetime, session_lifetime)
+}
+
+// storeValue returns the StoreItem of key, or an empty StoreItem where key is
+// not in the Store.
+func (env *Env) storeValue(key string) StoreItem {
+	if item, ok := env.Store[key]; ok && item != nil {
+		return *item
+	}
+	return StoreItem{}
 }
 
 func (env *Env) defaultsessionmanager() *session.Manager {
-	d, err := session.NewManager("cookie", env.defaultsessionconfig())
+	provider := env.Store["SESSION_PROVIDER"].Value
+	if provider == "sql" && env.storeValue("SESSION_DRIVER").Value == "" {
+		panic("Problem with [FLOTILLA] default session manager: the sql session provider requires [session] driver & dsn")
+	}
+	d, err := session.NewManager(provider, env.defaultsessionconfig(provider))
 	if err != nil {
 		panic(fmt.Sprintf("Problem with [FLOTILLA] default session manager: %s", err))
 	}
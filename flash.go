@@ -0,0 +1,53 @@
+package flotilla
+
+import (
+	"encoding/gob"
+
+	"github.com/thrisp/flotilla/session"
+)
+
+type (
+	// A FlashMessage is a message set in the session for a following request,
+	// with a category and optional structured data.
+	FlashMessage struct {
+		Category string
+		Message  string
+		Data     map[string]interface{}
+	}
+
+	// Flashes is an ordered list of FlashMessage, in the order they were set.
+	Flashes []FlashMessage
+)
+
+// Filter returns the flashes in any of the categories, or all flashes if no
+// categories are provided, keeping their order.
+func (f Flashes) Filter(categories ...string) Flashes {
+	matched, _ := f.split(categories)
+	return matched
+}
+
+// Messages returns the message strings of the flashes in order.
+func (f Flashes) Messages() []string {
+	var ret []string
+	for _, fl := range f {
+		ret = append(ret, fl.Message)
+	}
+	return ret
+}
+
+func (f Flashes) split(categories []string) (Flashes, Flashes) {
+	var matched, rest Flashes
+	for _, fl := range f {
+		if len(categories) == 0 || existsIn(fl.Category, categories) {
+			matched = append(matched, fl)
+		} else {
+			rest = append(rest, fl)
+		}
+	}
+	return matched, rest
+}
+
+func init() {
+	gob.Register(Flashes{})
+	session.RegisterJSONType("flotilla.Flashes", Flashes{})
+}
@@ -2,6 +2,7 @@ package flotilla
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -40,7 +41,27 @@ func (app *App) Name() string {
 	return app.name
 }
 
+// Close releases resources held by the App for its lifetime, stopping the
+// watchers of the default Staticor & Templator in development mode, started on
+// their first use, or of any Staticor or Templator that is an io.Closer. Run
+// closes the App when serving ends; an App served otherwise, e.g. by
+// http.Server, is closed on shutdown.
+func (app *App) Close() error {
+	var err error
+	for _, c := range []interface{}{app.Env.Staticor, app.Env.Templator} {
+		if closer, ok := c.(io.Closer); ok {
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// Run configures the App where not yet configured, and serves it on addr,
+// closing the App when serving ends.
 func (app *App) Run(addr string) {
+	defer app.Close()
 	if !app.Configured {
 		if err := app.Configure(app.Configuration...); err != nil {
 			panic(fmt.Sprintf("[FLOTILLA] app could not be configured properly: %s", err))
@@ -1,12 +1,33 @@
 package flotilla
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"math/rand"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/thrisp/engine"
 	"golang.org/x/net/context"
 )
 
@@ -54,9 +75,121 @@ func (te *TestEngine) Reconfigure(func() error) error {
 func (te *TestEngine) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	path := req.URL.Path
 	method := req.Method
-	if rt, ok := te.routes[fmt.Sprintf("%s:%s", method, path)]; ok {
-		rt(context.WithValue(context.Background(), "current", true))
+	rt, ok := te.routes[fmt.Sprintf("%s:%s", method, path)]
+	if !ok {
+		rt, ok = te.routes[fmt.Sprintf("%s:%s", path, method)]
 	}
+	params := make(map[string]string)
+	if !ok {
+		// the most specific matching route, by the length of its static prefix
+		longest := -1
+		for k, h := range te.routes {
+			m, route := testRouteKey(k)
+			if m != method {
+				continue
+			}
+			if p, matched := (&Route{path: route}).match(path); matched {
+				if prefix := strings.IndexAny(route+":", ":*"); prefix > longest {
+					rt, ok, params, longest = h, true, p, prefix
+				}
+			}
+		}
+	}
+	if ok {
+		c := context.WithValue(context.Background(), "current", true)
+		tc := newTestCurrent(res, req)
+		tc.params = params
+		c = context.WithValue(c, "Current", tc)
+		rt(c)
+		tc.rw.WriteHeaderNow()
+	}
+}
+
+// testRouteKey returns the method & route of a TestEngine route key, taken as
+// "method:route" by the test engine or as "route:method" from an App.
+func testRouteKey(k string) (method, route string) {
+	if strings.HasPrefix(k, "/") {
+		i := strings.LastIndex(k, ":")
+		return k[i+1:], k[:i]
+	}
+	m := strings.SplitN(k, ":", 2)
+	return m[0], m[1]
+}
+
+// testCurrent supplies the Current interface to flotilla from the test engine.
+type testCurrent struct {
+	req    *http.Request
+	rw     *testResponseWriter
+	data   map[string]interface{}
+	params map[string]string
+}
+
+func newTestCurrent(res http.ResponseWriter, req *http.Request) *testCurrent {
+	return &testCurrent{req: req, rw: &testResponseWriter{ResponseWriter: res}, data: make(map[string]interface{})}
+}
+
+func (tc *testCurrent) Request() *http.Request                    { return tc.req }
+func (tc *testCurrent) Data() map[string]interface{}              { return tc.data }
+func (tc *testCurrent) Form() url.Values                          { tc.parse(); return tc.req.Form }
+func (tc *testCurrent) Files() map[string][]*multipart.FileHeader { tc.parse(); return tc.files() }
+func (tc *testCurrent) StatusFunc() (func(int), bool)             { return nil, false }
+func (tc *testCurrent) Writer() engine.ResponseWriter             { return tc.rw }
+func (tc *testCurrent) Params() map[string]string                 { return tc.params }
+
+func (tc *testCurrent) parse() {
+	if err := tc.req.ParseMultipartForm(1 << 20); err != nil {
+		tc.req.ParseForm()
+	}
+}
+
+func (tc *testCurrent) files() map[string][]*multipart.FileHeader {
+	if tc.req.MultipartForm != nil {
+		return tc.req.MultipartForm.File
+	}
+	return nil
+}
+
+type testResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	size    int
+	written bool
+}
+
+func (w *testResponseWriter) WriteHeader(code int) {
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *testResponseWriter) WriteHeaderNow() {
+	if !w.written {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		w.written = true
+	}
+}
+
+func (w *testResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *testResponseWriter) Status() int   { return w.status }
+func (w *testResponseWriter) Size() int     { return w.size }
+func (w *testResponseWriter) Written() bool { return w.written }
+func (w *testResponseWriter) Flush()        {}
+
+func (w *testResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("test response writer cannot be hijacked")
+}
+
+func (w *testResponseWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
 }
 
 func testCustomEngine(method string, t *testing.T) {
@@ -207,3 +340,1117 @@ func TestMountBlueprint(t *testing.T) {
 		testMountBlueprint(m, t)
 	}
 }
+
+func TestSecureCookie(t *testing.T) {
+	f := New("flotilla_test_SecureCookie", TestingEngine, EnvItem("secret_key:newkey", "secret_fallbacks:oldkey", "cookie_signedmaxage:60"))
+	f.Configure(f.Configuration...)
+
+	oldsigner := &CookieSigner{Keys: []string{"oldkey"}, Salt: defaultCookieSalt}
+	vs := base64.URLEncoding.EncodeToString([]byte("value"))
+	expired := signedCookieMarker + strings.Join([]string{vs, "1", hex.EncodeToString(oldsigner.signature("oldkey", "expired", vs, "1"))}, "|")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "plain", Value: "plain"})
+	req.AddCookie(&http.Cookie{Name: "piped", Value: "a|b|c"})
+	req.AddCookie(&http.Cookie{Name: "rotated", Value: oldsigner.Sign("rotated", "value")})
+	req.AddCookie(&http.Cookie{Name: "moved", Value: oldsigner.Sign("rotated", "value")})
+	req.AddCookie(&http.Cookie{Name: "expired", Value: expired})
+	ctx := &Ctx{App: f, Request: req}
+
+	values, errs := ctx.ReadCookies()
+	if values["plain"] != "plain" {
+		t.Errorf("plain cookie was not read")
+	}
+	if values["piped"] != "a|b|c" || errs["piped"] != nil {
+		t.Errorf("plain cookie of three parts was read as signed: %v", errs["piped"])
+	}
+	if values["rotated"] != "value" {
+		t.Errorf("cookie signed with a fallback key was not read: %v", errs["rotated"])
+	}
+	if errs["moved"] != ErrCookieTampered {
+		t.Errorf("cookie signed for another name was not reported as tampered")
+	}
+	if errs["expired"] != ErrCookieExpired {
+		t.Errorf("cookie signed past max age was not reported as expired")
+	}
+	if _, err := ctx.CookieSigner("purpose").Unsign("rotated", oldsigner.Sign("rotated", "value"), 0); err != ErrCookieTampered {
+		t.Errorf("cookie signed with another salt was not reported as tampered")
+	}
+}
+
+func TestCookieOptions(t *testing.T) {
+	f := New("flotilla_test_CookieOptions", TestingEngine, EnvItem("cookie_path:/", "cookie_httponly:true", "cookie_samesite:lax"))
+	f.Configure(f.Configuration...)
+	ctx := &Ctx{App: f}
+
+	expires := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	cke := basiccookie("name", "value", ctx.cookieOptions([]CookieOption{
+		CookieExpires(expires),
+		CookieSameSite(http.SameSiteStrictMode),
+		CookiePriority("High"),
+		CookiePartitioned(true),
+	}))
+	expected := "name=value; Expires=Fri, 02 Jan 2015 03:04:05 GMT; Path=/; Secure; HttpOnly; SameSite=Strict; Priority=High; Partitioned"
+	if cke != expected {
+		t.Errorf("cookie was %q, expected %q", cke, expected)
+	}
+
+	deleted := basiccookie("name", "", ctx.cookieOptions([]CookieOption{CookieMaxAge(-1)}))
+	if deleted != "name=; Max-Age=0; Path=/; HttpOnly; SameSite=Lax" {
+		t.Errorf("deleted cookie was %q", deleted)
+	}
+}
+
+func TestLazySession(t *testing.T) {
+	f := New("flotilla_test_LazySession", TestingEngine)
+	var sessionless bool
+	var read interface{}
+	var late error
+	f.GET("/untouched", func(ctx *Ctx) { ctx.Session.Get("key") })
+	f.GET("/modified", func(ctx *Ctx) { ctx.Session.Set("key", "value") })
+	f.GET("/read", func(ctx *Ctx) { read = ctx.Session.Get("key") })
+	f.GET("/late", func(ctx *Ctx) {
+		ctx.Push(func(c *Ctx) { late = c.Session.Set("key", "late") })
+	})
+	r := NewRoute("GET", "/disabled", false, []HandlerFunc{func(ctx *Ctx) {
+		sessionless = ctx.Session.Set("key", "value") == ErrSessionDisabled && ctx.Session.Get("key") == nil
+		ctx.RegenerateSession()
+		ctx.Flash("info", "unsaved")
+	}})
+	r.DisableSessions()
+	f.Handle(r)
+	f.Configure(f.Configuration...)
+
+	if w := PerformRequest(f, "GET", "/untouched"); w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("an unmodified session was released: %s", w.Header().Get("Set-Cookie"))
+	}
+	w := PerformRequest(f, "GET", "/modified")
+	if w.Header().Get("Set-Cookie") == "" {
+		t.Errorf("a modified session was not released")
+	}
+	req, _ := http.NewRequest("GET", "/read", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rw := httptest.NewRecorder()
+	f.ServeHTTP(rw, req)
+	if read != "value" || rw.Header().Get("Set-Cookie") == "" {
+		t.Errorf("a read cookie session was not re-issued: %v, %q", read, rw.Header().Get("Set-Cookie"))
+	}
+	if PerformRequest(f, "GET", "/late"); late != ErrSessionReleased {
+		t.Errorf("a change after the session was released returned %v", late)
+	}
+	w = PerformRequest(f, "GET", "/disabled")
+	if !sessionless || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("a route with sessions disabled was provided a session")
+	}
+}
+
+func TestFlashMessages(t *testing.T) {
+	f := New("flotilla_test_FlashMessages", TestingEngine)
+	var peeked, consumed, remaining, all, empty []string
+	var data map[string]interface{}
+	f.GET("/flash", func(ctx *Ctx) {
+		ctx.Flash("error", "first")
+		ctx.FlashData("info", "second", map[string]interface{}{"field": "name"})
+		ctx.Flash("error", "third")
+		peeked = ctx.PeekFlashMessages("error").Messages()
+		consumed = ctx.FlashMessages("error").Messages()
+		remaining = ctx.PeekFlashMessages().Messages()
+		data = ctx.PeekFlashMessages("info")[0].Data
+		all = ctx.AllFlashMessages().Messages()
+		empty = ctx.AllFlashMessages().Messages()
+	})
+	f.Configure(f.Configuration...)
+	PerformRequest(f, "GET", "/flash")
+
+	expect := func(name string, got []string, expected ...string) {
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s flash messages were %v, expected %v", name, got, expected)
+		}
+	}
+	expect("peeked", peeked, "first", "third")
+	expect("consumed", consumed, "first", "third")
+	expect("remaining", remaining, "second")
+	expect("all", all, "second")
+	expect("empty", empty)
+	if data["field"] != "name" {
+		t.Errorf("flash message data was not kept")
+	}
+
+	td := TData{"Flash": Flashes{{"error", "one", nil}, {"info", "two", nil}}}
+	expect("template peeked", td.PeekFlashMessages("info").Messages(), "two")
+	expect("template consumed", td.GetFlashMessages("info").Messages(), "two")
+	expect("template remaining", td.GetFlashMessages().Messages(), "one")
+}
+
+func TestStaticFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla_static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("css"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644)
+
+	f := New("flotilla_test_StaticFiles", TestingEngine, Mode("development", true))
+	f.STATIC("/static/css")
+	f.Configure(f.Configuration...)
+	f.StaticDirs(dir)
+	s := f.Staticor.(*staticor)
+	defer s.watcher.Stop()
+
+	expect := func(path string, code int, body string) {
+		w := PerformRequest(f, "GET", path)
+		if w.Code != code || (body != "" && w.Body.String() != body) {
+			t.Errorf("%s returned %d %q, expected %d %q", path, w.Code, w.Body.String(), code, body)
+		}
+	}
+	expect("/static/css/css/app.css", 200, "css")
+	expect("/static/css/app.css", 404, "")
+	expect("/static/css/../secret", 404, "")
+	expect("/static/css/css/../../secret", 404, "")
+
+	ioutil.WriteFile(filepath.Join(dir, "css", "new.css"), []byte("new"), 0644)
+	if !s.watcher.check() {
+		t.Errorf("static directory change was not detected")
+	}
+	expect("/static/css/css/new.css", 200, "new")
+}
+
+func TestStaticCaching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla_static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app.css"), []byte("body {}"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.css.gz"), []byte("gzipped"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("js"), 0644)
+
+	f := New("flotilla_test_StaticCaching", TestingEngine,
+		EnvItem("static_cachecontrol:no-cache", "static_cachecontrol.css:public, max-age=3600"))
+	f.STATIC("/assets")
+	f.Configure(f.Configuration...)
+	f.StaticDirs(dir)
+
+	request := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/assets/app.css")
+	etag := w.Header().Get("Etag")
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("static file returned %d with ETag %q", w.Code, etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("extension Cache-Control was %q", cc)
+	}
+	if w = request("/assets/app.css", "If-None-Match", etag); w.Code != 304 {
+		t.Errorf("matching If-None-Match returned %d, expected 304", w.Code)
+	}
+	if w = request("/assets/app.js"); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("default Cache-Control was %q", w.Header().Get("Cache-Control"))
+	}
+
+	w = request("/assets/app.css", "Accept-Encoding", "br;q=0, gzip")
+	if w.Body.String() != "gzipped" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("precompressed file was not served: %q %q", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("precompressed file Content-Type was %q", ct)
+	}
+	if w.Header().Get("Etag") == etag {
+		t.Errorf("precompressed file had the ETag of the uncompressed file")
+	}
+
+	a := NewAssetFile("asset.txt", []byte("asset"))
+	if a.Size() != 5 || a.ModTime().IsZero() {
+		t.Errorf("asset file size %d, modification time %s", a.Size(), a.ModTime())
+	}
+}
+
+func TestStaticUrl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla_static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("body {}"), 0644)
+
+	var url, missing string
+	f := New("flotilla_test_StaticUrl", TestingEngine)
+	f.GET("/page", func(ctx *Ctx) {
+		url = ctx.StaticUrl("css/app.css")
+		missing = ctx.StaticUrl("css/missing.css")
+	})
+	f.Configure(f.Configuration...)
+	f.StaticDirs(dir)
+	PerformRequest(f, "GET", "/page")
+
+	if !regexp.MustCompile(`^/static/css/app\.[0-9a-f]{8}\.css$`).MatchString(url) {
+		t.Fatalf("static url was %q", url)
+	}
+	if !strings.Contains(missing, "unavailable") {
+		t.Errorf("static url for a missing file was %q", missing)
+	}
+	w := PerformRequest(f, "GET", url)
+	if w.Code != 200 || w.Body.String() != "body {}" {
+		t.Errorf("fingerprinted url returned %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != immutableCacheControl {
+		t.Errorf("fingerprinted url Cache-Control was %q", cc)
+	}
+	if w = PerformRequest(f, "GET", "/static/css/app.00000000.css"); w.Code != 404 {
+		t.Errorf("stale fingerprinted url returned %d, expected 404", w.Code)
+	}
+	if fn, ok := f.tplfunctions["staticurl"].(func(string) string); !ok || fn("css/app.css") != url {
+		t.Errorf("staticurl template function did not return %q", url)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"templates/index.html":        {Data: []byte("index template")},
+		"templates/admin/secret.html": {Data: []byte("secret template")},
+		"static/css/site.css":         {Data: []byte("site css"), ModTime: time.Unix(1000, 0)},
+		"other/deep/index.html":       {Data: []byte("other template")},
+	}
+	bindata := map[string][]byte{"static/js/app.js": []byte("app js"), "robots.txt": []byte("robots")}
+	bindirs := map[string][]string{"": {"robots.txt", "static"}, "static": {"js"}, "static/js": {"app.js"}}
+	assetfs := &AssetFS{
+		Asset: func(name string) ([]byte, error) {
+			if b, ok := bindata[name]; ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("asset %s not found", name)
+		},
+		AssetDir: func(name string) ([]string, error) {
+			if children, ok := bindirs[name]; ok {
+				return children, nil
+			}
+			return nil, fmt.Errorf("%s is not a directory", name)
+		},
+		AssetNames: func() []string {
+			return []string{"robots.txt", "static/js/app.js"}
+		},
+	}
+	var _ http.FileSystem = assetfs
+	var walked []string
+	fs.WalkDir(assetfs.FS(), ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			walked = append(walked, name)
+		}
+		return err
+	})
+	if strings.Join(walked, ",") != "robots.txt,static/js/app.js" {
+		t.Errorf("walking AssetFS.FS found %v", walked)
+	}
+	for _, name := range []string{"/robots.txt", "static/../robots.txt", "static/"} {
+		if _, err := assetfs.FS().Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("AssetFS.FS opened the invalid name %q: %v", name, err)
+		}
+	}
+
+	f := New("flotilla_test_Assets", TestingEngine, Asset(mapfs, assetfs.FS()))
+	f.Configure(f.Configuration...)
+
+	l := NewLoader(f.Env)
+	if tpl, err := l.Load("index.html"); err != nil || tpl != "index template" {
+		t.Errorf("template from fs.FS was %q, %v", tpl, err)
+	}
+	if tpl, err := l.Load("deep/index.html"); err == nil {
+		t.Errorf("template matched by the trailing segments of its name: %q", tpl)
+	}
+	if !existsIn("templates/index.html", l.ListTemplates().([]string)) {
+		t.Errorf("templates listed did not include the fs.FS template: %v", l.ListTemplates())
+	}
+
+	w := PerformRequest(f, "GET", "/static/css/site.css")
+	if w.Code != 200 || w.Body.String() != "site css" {
+		t.Errorf("static file from fs.FS returned %d %q", w.Code, w.Body.String())
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != time.Unix(1000, 0).UTC().Format(http.TimeFormat) {
+		t.Errorf("static file from fs.FS Last-Modified was %q", lm)
+	}
+	if w = PerformRequest(f, "GET", "/static/js/app.js"); w.Code != 200 || w.Body.String() != "app js" {
+		t.Errorf("static file from AssetFS returned %d %q", w.Code, w.Body.String())
+	}
+	if w = PerformRequest(f, "GET", "/static/robots.txt"); w.Code != 200 || w.Body.String() != "robots" {
+		t.Errorf("static file from the AssetFS root returned %d %q", w.Code, w.Body.String())
+	}
+	for _, requested := range []string{"/static/secret.html", "/static/admin/secret.html", "/static/templates/admin/secret.html"} {
+		if w = PerformRequest(f, "GET", requested); w.Code != 404 || strings.Contains(w.Body.String(), "secret template") {
+			t.Errorf("template outside the static directory was served for %s: %d %q", requested, w.Code, w.Body.String())
+		}
+	}
+	if b, err := f.Assets.GetByte("templates/index.html"); err != nil || string(b) != "index template" {
+		t.Errorf("asset bytes from fs.FS were %q, %v", b, err)
+	}
+}
+
+func TestTemplateDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "admin", "users"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "admin", "users", "list.html"), []byte("users list"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "base.html"), []byte("directory base"), 0644)
+
+	f := New("flotilla_test_TemplateDiscovery", TestingEngine,
+		EnvItem("template_directories:"+dir),
+		Asset(fstest.MapFS{"base.html": {Data: []byte("asset base")}}),
+		TemplateNamespace("shop", fstest.MapFS{"list.html": {Data: []byte("shop list")}}))
+	admin := NewBlueprint("/admin")
+	admin.TemplateNamespace("admin", fstest.MapFS{"list.html": {Data: []byte("admin list")}})
+	f.RegisterBlueprints(admin)
+	f.Configure(f.Configuration...)
+
+	l := NewLoader(f.Env)
+	for name, expected := range map[string]string{
+		"admin/users/list.html": "users list",
+		"base.html":             "directory base",
+		"admin:list.html":       "admin list",
+		"shop:list.html":        "shop list",
+	} {
+		if tpl, err := l.Load(name); err != nil || tpl != expected {
+			t.Errorf("template %s was %q, %v, expected %q", name, tpl, err, expected)
+		}
+	}
+	for _, name := range []string{"missing:list.html", "admin:base.html", "../base.html", "admin/../../base.html"} {
+		if _, err := l.Load(name); err == nil {
+			t.Errorf("template %s was loaded", name)
+		}
+	}
+	listed := strings.Join(l.ListTemplates().([]string), ",")
+	if listed != "admin/users/list.html,base.html,admin:list.html,shop:list.html" {
+		t.Errorf("templates listed were %s", listed)
+	}
+}
+
+func TestTemplateCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tpl := filepath.Join(dir, "page.html")
+	ioutil.WriteFile(tpl, []byte("first"), 0644)
+
+	render := func(tr Templator) string {
+		var b bytes.Buffer
+		if err := tr.Render(&b, "page.html", nil); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	production := New("flotilla_test_TemplateCache", TestingEngine,
+		Mode("development", false), Mode("production", true), EnvItem("template_directories:"+dir))
+	production.Configure(production.Configuration...)
+	render(production.Templator)
+	ioutil.WriteFile(tpl, []byte("second"), 0644)
+	if s := render(production.Templator); s != "first" {
+		t.Errorf("production template was recompiled as %q", s)
+	}
+	stats := production.Templator.(TemplateCacher).CacheStats()
+	if !stats.Enabled || stats.Watching || stats.Hits != 1 || stats.Misses != 1 || len(stats.Templates) != 1 {
+		t.Errorf("production template cache stats were %+v", stats)
+	}
+
+	development := New("flotilla_test_TemplateCache", TestingEngine, EnvItem("template_directories:"+dir))
+	development.Configure(development.Configuration...)
+	dt := development.Templator.(*templator)
+	defer dt.cache.watcher.Stop()
+	if dt.cache.watcher.started {
+		t.Errorf("development template watcher was started before any render")
+	}
+	if s := render(dt); s != "second" || !dt.cache.watcher.started {
+		t.Errorf("development template was %q, watched %t", s, dt.cache.watcher.started)
+	}
+	if s := render(dt); s != "second" || dt.CacheStats().Hits != 1 {
+		t.Errorf("development template was not cached: %q, %+v", s, dt.CacheStats())
+	}
+	ioutil.WriteFile(tpl, []byte("third, changed"), 0644)
+	dt.cache.watcher.check()
+	if s := render(dt); s != "third, changed" {
+		t.Errorf("development template was not recompiled on change: %q", s)
+	}
+	if stats = dt.CacheStats(); !stats.Watching || stats.Invalidated.IsZero() {
+		t.Errorf("development template cache stats were %+v", stats)
+	}
+}
+
+func TestHTMLTemplator(t *testing.T) {
+	templates := fstest.MapFS{
+		"layout.html": {Data: []byte(`<title>{{block "title" .}}Default{{end}}</title>{{template "nav.html" .}}<main>{{block "content" .}}{{end}}</main>`)},
+		"nav.html":    {Data: []byte(`<nav>{{upper "nav"}} {{.UrlFor "page" false}}</nav>`)},
+		"page.html":   {Data: []byte(`{{extends "layout.html"}}{{define "content"}}{{.Name}} {{.STRING "greeting"}}{{end}}`)},
+		"loop.html":   {Data: []byte(`{{extends "loop.html"}}`)},
+	}
+	f := New("flotilla_test_HTMLTemplator", TestingEngine,
+		Asset(templates),
+		Templating(NewHTMLTemplator(nil)),
+		TemplateFunction("upper", strings.ToUpper),
+		CtxProcessor("greeting", func(ctx *Ctx) string { return "hello" }))
+	var rendered bytes.Buffer
+	var loopErr error
+	page := NewRoute("GET", "/page", false, []HandlerFunc{func(ctx *Ctx) {
+		td := TemplateData(ctx, map[string]interface{}{"Name": "<b>name</b>"})
+		ctx.App.Templator.Render(&rendered, "page.html", td)
+		loopErr = ctx.App.Templator.Render(ioutil.Discard, "loop.html", td)
+	}})
+	page.Name = "page"
+	f.Handle(page)
+	f.Configure(f.Configuration...)
+	PerformRequest(f, "GET", "/page")
+
+	expected := `<title>Default</title><nav>NAV /page</nav><main>&lt;b&gt;name&lt;/b&gt; hello</main>`
+	if rendered.String() != expected {
+		t.Errorf("html template rendered %q, expected %q", rendered.String(), expected)
+	}
+	if loopErr == nil {
+		t.Errorf("a template extending itself was rendered")
+	}
+	if h, ok := f.Templator.(*HTMLTemplator); !ok || !existsIn("page.html", h.ListTemplates()) {
+		t.Errorf("html templator did not list templates")
+	}
+}
+
+func TestRenderToString(t *testing.T) {
+	templates := fstest.MapFS{
+		"fragment.html": {Data: []byte(`<p>{{.Any}} {{.UrlFor "fragment" false}}</p>`)},
+		"broken.html":   {Data: []byte(`{{template "missing" .}}`)},
+	}
+	f := New("flotilla_test_RenderToString", TestingEngine, Asset(templates), Templating(NewHTMLTemplator(nil)))
+	var fragment string
+	var fragmentErr error
+	var errs errorMsgs
+	rt := NewRoute("GET", "/fragment", false, []HandlerFunc{func(ctx *Ctx) {
+		fragment, fragmentErr = ctx.RenderToString("fragment.html", "partial")
+		ctx.RenderTemplate("fragment.html", "full")
+	}})
+	rt.Name = "fragment"
+	f.Handle(rt)
+	f.GET("/broken", func(ctx *Ctx) {
+		ctx.RenderTemplate("broken.html", nil)
+		ctx.Push(func(c *Ctx) { errs = c.Errors() })
+	})
+	f.Configure(f.Configuration...)
+
+	w := PerformRequest(f, "GET", "/fragment")
+	if fragmentErr != nil || fragment != "<p>partial /fragment</p>" {
+		t.Errorf("rendered to string %q, %v", fragment, fragmentErr)
+	}
+	if w.Body.String() != "<p>full /fragment</p>" {
+		t.Errorf("rendered response %q", w.Body.String())
+	}
+
+	b, err := f.RenderTemplate("fragment.html", "outside")
+	if err != nil || string(b) != "<p>outside /fragment</p>" {
+		t.Errorf("rendered outside a request %q, %v", b, err)
+	}
+	if _, err = f.RenderTemplate("missing.html", nil); err == nil {
+		t.Errorf("rendering a missing template returned no error")
+	}
+
+	w = PerformRequest(f, "GET", "/broken")
+	if w.Code != 500 || w.Body.Len() != 0 {
+		t.Errorf("broken template responded %d %q", w.Code, w.Body.String())
+	}
+	if len(errs) != 1 || errs[0].Meta != "broken.html" {
+		t.Errorf("broken template errors were %v", errs)
+	}
+}
+
+func TestServeEncoded(t *testing.T) {
+	type item struct {
+		Name  string `json:"name" xml:"name"`
+		Count int    `json:"count" xml:"count"`
+	}
+	f := New("flotilla_test_ServeEncoded", TestingEngine, Mode("development", false))
+	f.GET("/json", func(ctx *Ctx) { ctx.ServeJSON(201, item{"a", 1}) })
+	f.GET("/jsonp", func(ctx *Ctx) { ctx.ServeJSONP(200, "", item{"a", 1}) })
+	f.GET("/xml", func(ctx *Ctx) { ctx.ServeXML(200, item{"a", 1}) })
+	f.GET("/unencodable", func(ctx *Ctx) { ctx.ServeJSON(200, func() {}) })
+	f.Configure(f.Configuration...)
+
+	expect := func(path string, code int, ctype, body string) {
+		w := PerformRequest(f, "GET", path)
+		if w.Code != code || w.Header().Get("Content-Type") != ctype || w.Body.String() != body {
+			t.Errorf("%s responded %d %q %q, expected %d %q %q", path, w.Code, w.Header().Get("Content-Type"), w.Body.String(), code, ctype, body)
+		}
+	}
+	expect("/json", 201, "application/json; charset=utf-8", `{"name":"a","count":1}`)
+	expect("/jsonp?callback=app.receive", 200, "application/javascript; charset=utf-8", `/**/ app.receive({"name":"a","count":1});`)
+	expect("/jsonp?callback=alert(1)", 400, "", "")
+	expect("/xml", 200, "application/xml; charset=utf-8", xml.Header+`<item><name>a</name><count>1</count></item>`)
+	expect("/unencodable", 500, "", "")
+
+	f.Mode.Development = true
+	expect("/json", 201, "application/json; charset=utf-8", "{\n  \"name\": \"a\",\n  \"count\": 1\n}")
+}
+
+func TestBind(t *testing.T) {
+	type Paging struct {
+		Page int `form:"page" default:"1" json:"page"`
+	}
+	type Sorting struct {
+		Sort  string `form:"sort" default:"name" json:"sort"`
+		Order string `form:"order" json:"order"`
+	}
+	type search struct {
+		Paging
+		*Sorting
+		Query   string                  `form:"q" json:"q"`
+		Tags    []string                `form:"tag" json:"tags"`
+		Exact   bool                    `form:"exact" json:"exact"`
+		Timeout time.Duration           `form:"timeout" default:"5s" json:"-"`
+		Limit   *uint                   `form:"limit" json:"limit"`
+		Upload  *multipart.FileHeader   `form:"upload" json:"-"`
+		Extra   []*multipart.FileHeader `form:"extra" json:"-"`
+		Ignored string                  `form:"-" default:"ignored"`
+	}
+	var bound search
+	var bindErr error
+	f := New("flotilla_test_Bind", TestingEngine)
+	f.GET("/search", func(ctx *Ctx) { bound = search{}; bindErr = ctx.Bind(&bound) })
+	f.POST("/search", func(ctx *Ctx) { bound = search{}; bindErr = ctx.Bind(&bound) })
+	f.Configure(f.Configuration...)
+
+	request := func(method, target, ctype string, body io.Reader) {
+		req, _ := http.NewRequest(method, target, body)
+		if ctype != "" {
+			req.Header.Set("Content-Type", ctype)
+		}
+		f.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	request("GET", "/search?q=go&tag=a&tag=b&exact=on&limit=10", "", nil)
+	if bindErr != nil || bound.Query != "go" || strings.Join(bound.Tags, ",") != "a,b" || !bound.Exact ||
+		bound.Page != 1 || bound.Timeout != 5*time.Second || bound.Limit == nil || *bound.Limit != 10 || bound.Ignored != "" {
+		t.Errorf("query bound %+v, %v", bound, bindErr)
+	}
+	request("GET", "/search?order=desc", "", nil)
+	if bindErr != nil || bound.Sorting == nil || bound.Sort != "name" || bound.Order != "desc" {
+		t.Errorf("embedded pointer bound %+v, %v", bound.Sorting, bindErr)
+	}
+
+	request("POST", "/search", "application/x-www-form-urlencoded", strings.NewReader("q=form&page=3&timeout=1m"))
+	if bindErr != nil || bound.Query != "form" || bound.Page != 3 || bound.Timeout != time.Minute {
+		t.Errorf("urlencoded form bound %+v, %v", bound, bindErr)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("q", "multipart")
+	fw, _ := mw.CreateFormFile("upload", "upload.txt")
+	fw.Write([]byte("uploaded"))
+	mw.CreateFormFile("extra", "one.txt")
+	mw.CreateFormFile("extra", "two.txt")
+	mw.Close()
+	request("POST", "/search", mw.FormDataContentType(), &body)
+	if bindErr != nil || bound.Query != "multipart" || bound.Upload == nil || bound.Upload.Filename != "upload.txt" || len(bound.Extra) != 2 {
+		t.Errorf("multipart form bound %+v, %v", bound, bindErr)
+	}
+
+	request("POST", "/search?q=ignored", "application/json; charset=utf-8", strings.NewReader(`{"q":"json","tags":["x"],"page":2}`))
+	if bindErr != nil || bound.Query != "json" || bound.Tags[0] != "x" || bound.Page != 2 || bound.Timeout != 5*time.Second {
+		t.Errorf("json bound %+v, %v", bound, bindErr)
+	}
+
+	request("GET", "/search?page=first&limit=-1&exact=maybe", "", nil)
+	errs, ok := bindErr.(BindErrors)
+	if !ok || len(errs) != 3 || errs[0].Field != "Page" || errs[0].Name != "page" || errs[0].Value != "first" {
+		t.Errorf("binding errors were %#v", bindErr)
+	}
+
+	request("POST", "/search", "application/json", strings.NewReader(`{"q":`))
+	if errs, ok := bindErr.(BindErrors); !ok || len(errs) != 1 || errs[0].Field != "" {
+		t.Errorf("json binding error was %#v", bindErr)
+	}
+	request("POST", "/search", "text/csv", strings.NewReader("q"))
+	if bindErr == nil {
+		t.Errorf("an unsupported content type was bound")
+	}
+
+	f.Env.Store.add("upload", "size", "32")
+	request("POST", "/search", "application/json", strings.NewReader(`{"q":"`+strings.Repeat("x", 64)+`"}`))
+	if errs, ok := bindErr.(BindErrors); !ok || len(errs) != 1 || bound.Query != "" {
+		t.Errorf("a json body over the upload size was bound: %+v, %v", bound, bindErr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type Contact struct {
+		Email string `form:"email" validate:"required,email"`
+	}
+	type signup struct {
+		Contact
+		Name  string   `form:"name" validate:"required,min=2,max=8"`
+		Age   int      `form:"age" validate:"min=18,max=130"`
+		Plan  string   `form:"plan" validate:"oneof=free pro"`
+		Code  string   `form:"code" validate:"len=4,regexp=^[0-9,]+$"`
+		Tags  []string `form:"tag" validate:"max=2"`
+		Color string   `form:"color" validate:"hex"`
+	}
+	var validErr error
+	var td TData
+	hex := Validator("hex", func(value interface{}, param string) error {
+		if s, _ := value.(string); !strings.HasPrefix(s, "#") {
+			return errors.New("must be a hex color")
+		}
+		return nil
+	})
+	f := New("flotilla_test_Validate", TestingEngine, hex)
+	f.GET("/signup", func(ctx *Ctx) {
+		var s signup
+		validErr = ctx.BindValid(&s)
+		td = TemplateData(ctx, nil)
+	})
+	f.GET("/ref", func(ctx *Ctx) {
+		var s struct {
+			Ref string `form:"ref" validate:"min=3,required"`
+		}
+		validErr = ctx.BindValid(&s)
+	})
+	f.GET("/contact", func(ctx *Ctx) {
+		var s struct{ *Contact }
+		validErr = ctx.BindValid(&s)
+	})
+	f.Configure(f.Configuration...)
+
+	request := func(target string) {
+		req, _ := http.NewRequest("GET", target, nil)
+		f.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	request("/signup?email=a@example.com&name=ann&age=30&plan=pro&code=1,23&tag=x&color=%23fff")
+	if validErr != nil {
+		t.Errorf("valid signup had errors: %v", validErr)
+	}
+
+	request("/signup?email=nope&name=a&age=12&plan=gold&code=12345&tag=x&tag=y&tag=z&color=red")
+	errs, ok := validErr.(FieldErrors)
+	if !ok || len(errs) != 7 {
+		t.Fatalf("invalid signup errors were %#v", validErr)
+	}
+	expected := map[string]string{
+		"email": "email", "name": "min", "age": "min", "plan": "oneof",
+		"code": "len", "tag": "max", "color": "hex",
+	}
+	for _, err := range errs {
+		if expected[err.Name] != err.Rule {
+			t.Errorf("field %s failed rule %s, expected %s", err.Name, err.Rule, expected[err.Name])
+		}
+	}
+	if td.FieldError("color") != "must be a hex color" || td.FieldError("plan") != "must be one of free, pro" {
+		t.Errorf("template data field errors were %v", td["FieldErrors"])
+	}
+	b, _ := json.Marshal(errs[0])
+	if string(b) != `{"field":"Email","name":"email","rule":"email","message":"must be a valid email address"}` {
+		t.Errorf("field error json was %s", b)
+	}
+
+	request("/signup?age=0")
+	if errs, ok := validErr.(FieldErrors); !ok || len(errs) != 2 || errs[0].Rule != "required" || errs[1].Name != "name" {
+		t.Errorf("required errors were %#v", validErr)
+	}
+
+	request("/ref")
+	if errs, ok := validErr.(FieldErrors); !ok || len(errs) != 1 || errs[0].Name != "ref" {
+		t.Errorf("a field required after other rules was not validated: %#v", validErr)
+	}
+
+	request("/contact?email=nope")
+	if errs, ok := validErr.(FieldErrors); !ok || len(errs) != 1 || errs[0].Name != "email" {
+		t.Errorf("an embedded pointer to a struct was not validated: %#v", validErr)
+	}
+
+	r := New("flotilla_test_ValidateReported", TestingEngine, hex, CtxFunc("validationerrors", func(ctx *Ctx, errs FieldErrors) error {
+		ctx.ServeJSON(422, errs)
+		return nil
+	}))
+	r.GET("/signup", func(ctx *Ctx) { var s signup; validErr = ctx.BindValid(&s) })
+	r.Configure(r.Configuration...)
+	req, _ := http.NewRequest("GET", "/signup?name=a&color=%23000", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if validErr != nil || rec.Code != 422 || !strings.Contains(rec.Body.String(), `"is required"`) {
+		t.Errorf("overridden validation errors returned %v, served %d %s", validErr, rec.Code, rec.Body.String())
+	}
+}
+
+// plainCurrent hides the Params of a testCurrent, as a Current from an engine
+// not supplying route parameters.
+type plainCurrent struct {
+	Current
+}
+
+func TestDefaultCurrentParams(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/7/files/a/b.txt", nil)
+	// a Current without params, as from the default engine
+	current := struct{ Current }{newTestCurrent(httptest.NewRecorder(), req)}
+	dc := &defaultCurrent{Current: current, pattern: pathSegments("/users/:id/files/*path")}
+	var pc Current = dc
+	if _, ok := pc.(ParamsCurrent); !ok {
+		t.Fatal("default engine Current is not a ParamsCurrent")
+	}
+	if p := dc.Params(); p["id"] != "7" || p["path"] != "a/b.txt" {
+		t.Errorf("default engine Current params were %v", p)
+	}
+}
+
+func TestParams(t *testing.T) {
+	var params map[string]string
+	var id int
+	var id64 int64
+	var uuid string
+	var segments []string
+	var paramErr error
+	f := New("flotilla_test_Params", TestingEngine)
+	f.GET("/users/:id", func(ctx *Ctx) {
+		params = ctx.Params()
+		id, paramErr = ctx.ParamInt("id")
+	})
+	f.GET("/orders/:order/lines/:line", func(ctx *Ctx) {
+		params = ctx.Params()
+		id64, paramErr = ctx.ParamInt64("line")
+	})
+	f.GET("/items/:uuid", func(ctx *Ctx) {
+		uuid, paramErr = ctx.ParamUUID("uuid")
+	})
+	f.GET("/files/*path", func(ctx *Ctx) {
+		segments, paramErr = ctx.ParamPath("path")
+	})
+	f.GET("/missing/:id", func(ctx *Ctx) {
+		_, paramErr = ctx.ParamInt("other")
+	})
+	f.Configure(f.Configuration...)
+
+	request := func(target string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		f.ServeHTTP(rec, req)
+		return rec
+	}
+
+	request("/users/42")
+	if paramErr != nil || id != 42 || params["id"] != "42" {
+		t.Errorf("int param was %d, %v, %v", id, params, paramErr)
+	}
+	request("/orders/A7/lines/9000000000")
+	if paramErr != nil || id64 != 9000000000 || params["order"] != "A7" {
+		t.Errorf("int64 param was %d, %v, %v", id64, params, paramErr)
+	}
+	request("/items/6BA7B810-9DAD-11D1-80B4-00C04FD430C8")
+	if paramErr != nil || uuid != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("uuid param was %q, %v", uuid, paramErr)
+	}
+	request("/files/docs/guide/intro.md")
+	if paramErr != nil || strings.Join(segments, ",") != "docs,guide,intro.md" {
+		t.Errorf("splat param was %v, %v", segments, paramErr)
+	}
+
+	if rec := request("/users/ann"); rec.Code != 404 {
+		t.Errorf("an invalid int param responded %d, not 404", rec.Code)
+	}
+	if _, ok := paramErr.(*ParamError); !ok {
+		t.Errorf("an invalid int param error was %#v", paramErr)
+	}
+	if rec := request("/items/not-a-uuid"); rec.Code != 404 || paramErr == nil {
+		t.Errorf("an invalid uuid param responded %d, %v", rec.Code, paramErr)
+	}
+	if rec := request("/missing/1"); rec.Code != 404 || paramErr == nil {
+		t.Errorf("a missing param responded %d, %v", rec.Code, paramErr)
+	}
+
+	b := New("flotilla_test_ParamsBadRequest", TestingEngine, EnvItem("param_status:400"))
+	b.GET("/users/:id", func(ctx *Ctx) { _, paramErr = ctx.ParamInt("id") })
+	b.Configure(b.Configuration...)
+	req, _ := http.NewRequest("GET", "/users/ann", nil)
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+	if rec.Code != 400 || paramErr == nil {
+		t.Errorf("an invalid param with param_status 400 responded %d, %v", rec.Code, paramErr)
+	}
+
+	// params matched from the request path by the route, for an engine not
+	// supplying params
+	for _, rt := range f.Routes() {
+		if rt.path != "/orders/:order/lines/:line" {
+			continue
+		}
+		req, _ := http.NewRequest("GET", "/orders/B2/lines/3", nil)
+		tc := newTestCurrent(httptest.NewRecorder(), req)
+		rt.handle(context.WithValue(context.Background(), "Current", plainCurrent{tc}))
+		if paramErr != nil || id64 != 3 || params["order"] != "B2" {
+			t.Errorf("route matched params were %d, %v, %v", id64, params, paramErr)
+		}
+	}
+	for _, unmatched := range [][2]string{
+		{"/a/:b", "/a"},
+		{"/a/:b", "/a/b/c"},
+		{"/a/b", "/a/c"},
+		{"/a/:b/*c", "/a"},
+	} {
+		if _, ok := (&Route{path: unmatched[0]}).match(unmatched[1]); ok {
+			t.Errorf("route %s matched %s", unmatched[0], unmatched[1])
+		}
+	}
+}
+
+func TestRouteConverters(t *testing.T) {
+	var invoked string
+	var value interface{}
+	hex := RouteConverter("hex", func(arg string) (Converter, error) {
+		return hexConverter{}, nil
+	})
+	f := New("flotilla_test_RouteConverters", TestingEngine, hex)
+	f.GET("/user/:id<int>", func(ctx *Ctx) { invoked, value = "user", ctx.ParamValue("id") })
+	f.GET("/file/*path<path>", func(ctx *Ctx) { invoked, value = "file", ctx.ParamValue("path") })
+	f.GET("/v/:slug<re:[a-z-]+>", func(ctx *Ctx) { invoked, value = "slug", ctx.ParamValue("slug") })
+	f.GET("/price/:amount<float>", func(ctx *Ctx) { invoked, value = "price", ctx.ParamValue("amount") })
+	f.GET("/color/:color<hex>", func(ctx *Ctx) { invoked, value = "color", ctx.ParamValue("color") })
+	f.GET("/plain/:name", func(ctx *Ctx) { invoked, value = "plain", ctx.ParamValue("name") })
+	f.GET("/doc/*path<re:[a-z]+/[a-z]+>", func(ctx *Ctx) { invoked, value = "doc", ctx.ParamValue("path") })
+	f.Configure(f.Configuration...)
+
+	request := func(target string) int {
+		invoked, value = "", nil
+		req, _ := http.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		f.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for target, expected := range map[string]interface{}{
+		"/user/42":            42,
+		"/file/docs/guide.md": "docs/guide.md",
+		"/v/hello-world":      "hello-world",
+		"/price/9.5":          9.5,
+		"/color/ff00aa":       int64(0xff00aa),
+		"/plain/ann":          "ann",
+		"/doc/guide/intro":    "guide/intro",
+	} {
+		if code := request(target); code != 200 || invoked == "" || value != expected {
+			t.Errorf("%s responded %d with %#v, expected %#v", target, code, value, expected)
+		}
+	}
+	for _, target := range []string{"/user/ann", "/v/Hello_World", "/price/cheap", "/color/blue", "/doc/guide"} {
+		if code := request(target); code != 404 || invoked != "" {
+			t.Errorf("%s responded %d, invoking %q, expected a 404", target, code, invoked)
+		}
+	}
+
+	for _, rt := range f.Routes() {
+		switch rt.path {
+		case "/user/:id<int>":
+			if u, err := rt.Url("7"); err != nil || u.String() != "/user/7" {
+				t.Errorf("user url was %v, %v", u, err)
+			}
+			if _, err := rt.Url("seven"); err == nil {
+				t.Errorf("user url formatted a param not matching its converter")
+			}
+		case "/file/*path<path>":
+			if u, err := rt.Url("a", "b.txt"); err != nil || u.String() != "/file/a/b.txt" {
+				t.Errorf("file url was %v, %v", u, err)
+			}
+		case "/v/:slug<re:[a-z-]+>":
+			if _, err := rt.Url("Not A Slug"); err == nil {
+				t.Errorf("slug url formatted a param not matching its regexp")
+			}
+		case "/color/:color<hex>":
+			if u, err := rt.Url("00ff00"); err != nil || u.String() != "/color/00ff00" {
+				t.Errorf("color url was %v, %v", u, err)
+			}
+			if _, err := rt.Url("green"); err == nil {
+				t.Errorf("color url formatted a param not matching its custom converter")
+			}
+		}
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), `may not contain "/"`) {
+				t.Errorf("a :param converter containing \"/\" was registered: %v", r)
+			}
+		}()
+		f.GET("/bad/:slug<re:[a-z]+/[a-z]+>", func(ctx *Ctx) {})
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("a route with an unknown converter was registered")
+		}
+	}()
+	f.GET("/unknown/:id<nope>", func(ctx *Ctx) {})
+}
+
+type hexConverter struct{}
+
+func (hexConverter) Convert(value string) (interface{}, error) {
+	return strconv.ParseInt(value, 16, 64)
+}
+
+func (c hexConverter) Format(value interface{}) (string, error) {
+	s := fmt.Sprint(value)
+	_, err := c.Convert(s)
+	return s, err
+}
+
+func TestUrlFor(t *testing.T) {
+	var urls, optionUrls []string
+	var urlErrs, optionErrs []error
+	f := New("flotilla_test_UrlFor", TestingEngine)
+	user := NewRoute("GET", "/user/:id<int>", false, []HandlerFunc{func(ctx *Ctx) {}})
+	user.Name = "user"
+	f.Handle(user)
+	files := NewRoute("POST", "/files/:owner/*path", false, []HandlerFunc{func(ctx *Ctx) {}})
+	files.Name = "files"
+	f.Handle(files)
+	f.GET("/links", func(ctx *Ctx) {
+		urls, urlErrs = nil, nil
+		for _, params := range [][]interface{}{
+			{"id", 7},
+			{"id", 7, "tab", "posts & more", "_anchor", "top"},
+			{map[string]interface{}{"owner": "ann marie", "path": []string{"a b", "c.txt"}, "v": []string{"1", "2"}}},
+			{url.Values{"owner": {"ann"}, "path": {"d/e"}}},
+			{"id", 8, "_external", true},
+			{"id", 9, "_scheme", "https"},
+			{"tab", "posts"},
+			{"id", "seven"},
+			{"id"},
+		} {
+			route := "user"
+			if _, ok := params[0].(string); !ok {
+				route = "files"
+			}
+			u, err := ctx.UrlFor(route, params...)
+			urls, urlErrs = append(urls, u), append(urlErrs, err)
+		}
+		td := TemplateData(ctx, nil)
+		u, err := td.Url("user", "id", 10)
+		urls, urlErrs = append(urls, u), append(urlErrs, err)
+		_, err = ctx.UrlFor("nowhere")
+		urlErrs = append(urlErrs, err)
+		optionUrls, optionErrs = nil, nil
+		for _, params := range []interface{}{
+			url.Values{"id": {"11"}, "_external": {"true"}, "_anchor": {"top"}},
+			map[string]string{"id": "12", "_scheme": "https", "_external": "false"},
+			map[string]string{"id": "13", "_external": "maybe"},
+		} {
+			u, err := ctx.UrlFor("user", params)
+			optionUrls, optionErrs = append(optionUrls, u), append(optionErrs, err)
+		}
+	})
+	f.Configure(f.Configuration...)
+
+	req, _ := http.NewRequest("GET", "http://example.com/links", nil)
+	req.Host = "example.com"
+	f.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := []string{
+		"/user/7",
+		"/user/7?tab=posts+%26+more#top",
+		"/files/ann%20marie/a%20b/c.txt?v=1&v=2",
+		"/files/ann/d/e",
+		"http://example.com/user/8",
+		"https://example.com/user/9",
+	}
+	if len(urls) != 10 {
+		t.Fatalf("urls were %v, %v", urls, urlErrs)
+	}
+	for i, e := range expected {
+		if urls[i] != e || urlErrs[i] != nil {
+			t.Errorf("url was %q, %v, expected %q", urls[i], urlErrs[i], e)
+		}
+	}
+	for i := len(expected); i < len(expected)+3; i++ {
+		if urlErrs[i] == nil {
+			t.Errorf("url %q built without an error", urls[i])
+		}
+	}
+	if urls[9] != "/user/10" || urlErrs[9] != nil || urlErrs[10] == nil {
+		t.Errorf("template data url was %q, %v, unknown route error %v", urls[9], urlErrs[9], urlErrs[10])
+	}
+
+	if len(optionUrls) != 3 || optionUrls[0] != "http://example.com/user/11#top" || optionErrs[0] != nil ||
+		optionUrls[1] != "https://example.com/user/12" || optionErrs[1] != nil || optionErrs[2] == nil {
+		t.Errorf("urls with string options were %v, %v", optionUrls, optionErrs)
+	}
+	if fn, ok := f.tplfunctions["url"].(func(string, ...interface{}) string); !ok || fn("user", "id", 14) != "/user/14" {
+		t.Errorf("url template function was missing or did not return the route url")
+	}
+
+	if u, err := user.Url("7", "a=b=c", "d e"); err != nil || u.String() != "/user/7?a=b%3Dc&value2=d+e" {
+		t.Errorf("positional url was %v, %v", u, err)
+	}
+}
+
+func TestSqlSessionConfig(t *testing.T) {
+	f := New("flotilla_test_SqlSessionConfig", TestingEngine)
+	f.Env.Store.add("session", "driver", "postgres")
+	f.Env.Store.add("session", "dsn", "dbname=app")
+	f.Env.Store.add("session", "createschema", "true")
+	var cfg struct{ ProviderConfig string }
+	json.Unmarshal([]byte(f.Env.defaultsessionconfig("sql")), &cfg)
+	var sqlcfg map[string]interface{}
+	json.Unmarshal([]byte(cfg.ProviderConfig), &sqlcfg)
+	if sqlcfg["driver"] != "postgres" || sqlcfg["dsn"] != "dbname=app" || sqlcfg["createSchema"] != true || sqlcfg["serializer"] != "gob" {
+		t.Errorf("sql session provider config was %s", cfg.ProviderConfig)
+	}
+
+	missing := New("flotilla_test_SqlSessionConfigMissing", TestingEngine, EnvItem("session_provider:sql"))
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "driver & dsn") {
+			t.Errorf("a sql session provider without a driver recovered %v", r)
+		}
+	}()
+	missing.Configure(missing.Configuration...)
+}
+
+func TestAppClose(t *testing.T) {
+	production := New("flotilla_test_AppCloseProduction", TestingEngine, Mode("production", true))
+	production.Configure(production.Configuration...)
+	if s := production.Staticor.(*staticor); s.watcher != nil {
+		t.Errorf("production static index was watched")
+	}
+	if c := production.Templator.(*templator).cache; c == nil || c.watcher != nil {
+		t.Errorf("production template cache was %+v", c)
+	}
+
+	development := New("flotilla_test_AppCloseDevelopment", TestingEngine)
+	development.Configure(development.Configuration...)
+	sw, tw := development.Staticor.(*staticor).watcher, development.Templator.(*templator).cache.watcher
+	if sw == nil || tw == nil {
+		t.Fatalf("development watchers were %v, %v", sw, tw)
+	}
+	if sw.started || tw.started {
+		t.Errorf("development watchers were started before use")
+	}
+	development.Staticor.(*staticor).Fingerprint("missing.css")
+	if !sw.started {
+		t.Errorf("development static watcher was not started on use")
+	}
+	if err := development.Close(); err != nil {
+		t.Errorf("closing the app returned %v", err)
+	}
+	for _, w := range []*watcher{sw, tw} {
+		select {
+		case <-w.stop:
+		default:
+			t.Errorf("a watcher was not stopped by closing the app")
+		}
+	}
+}
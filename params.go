@@ -0,0 +1,134 @@
+package flotilla
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var regUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type (
+	// ParamsCurrent is a Current from an engine supplying the :param & *splat
+	// values of the matched route path, as the Current of the default engine
+	// does. It is kept apart from Current, so that engines without params
+	// remain a Current. For any other Current the values are matched from the
+	// request path by the route path, once per request on first use or for
+	// route converters.
+	ParamsCurrent interface {
+		Current
+		Params() map[string]string
+	}
+
+	// ParamError is an error getting a route parameter, where the parameter is
+	// missing from the route or its value is not of the requested type.
+	ParamError struct {
+		Name  string `json:"name"`
+		Value string `json:"value,omitempty"`
+		Err   string `json:"error"`
+	}
+)
+
+func (e *ParamError) Error() string {
+	return "param " + e.Name + ": " + e.Err
+}
+
+// Params returns the :param & *splat values of the route path, keyed by name.
+func (ctx *Ctx) Params() map[string]string {
+	if ctx.params == nil {
+		if pc, ok := ctx.current.(ParamsCurrent); ok {
+			ctx.params = pc.Params()
+		}
+		if ctx.params == nil && ctx.route != nil && ctx.Request != nil {
+			ctx.params, _ = ctx.route.match(ctx.Request.URL.Path)
+		}
+		if ctx.params == nil {
+			ctx.params = make(map[string]string)
+		}
+	}
+	return ctx.params
+}
+
+// Param returns the value of the named route parameter, or an empty string.
+func (ctx *Ctx) Param(name string) string {
+	return ctx.Params()[name]
+}
+
+func (ctx *Ctx) param(name string) (string, error) {
+	value, ok := ctx.Params()[name]
+	if !ok {
+		return "", ctx.paramError(&ParamError{Name: name, Err: "no such parameter"})
+	}
+	return value, nil
+}
+
+func (ctx *Ctx) paramError(err *ParamError) error {
+	ret, cerr := ctx.Call("paramerror", ctx, err)
+	if cerr != nil {
+		return cerr
+	}
+	if rerr, ok := ret.(error); ok {
+		return rerr
+	}
+	return err
+}
+
+// ParamInt returns the value of the named route parameter as an int.
+func (ctx *Ctx) ParamInt(name string) (int, error) {
+	n, err := ctx.ParamInt64(name)
+	return int(n), err
+}
+
+// ParamInt64 returns the value of the named route parameter as an int64.
+func (ctx *Ctx) ParamInt64(name string) (int64, error) {
+	value, err := ctx.param(name)
+	if err != nil {
+		return 0, err
+	}
+	n, perr := strconv.ParseInt(value, 10, 64)
+	if perr != nil {
+		return 0, ctx.paramError(&ParamError{name, value, "not an integer"})
+	}
+	return n, nil
+}
+
+// ParamUUID returns the value of the named route parameter as a lower case
+// uuid string, e.g. "6ba7b810-9dad-11d1-80b4-00c04fd430c8".
+func (ctx *Ctx) ParamUUID(name string) (string, error) {
+	value, err := ctx.param(name)
+	if err != nil {
+		return "", err
+	}
+	if !regUUID.MatchString(value) {
+		return "", ctx.paramError(&ParamError{name, value, "not a uuid"})
+	}
+	return strings.ToLower(value), nil
+}
+
+// ParamPath returns the value of the named route parameter, usually a *splat,
+// as a slice of path segments, e.g. "a/b/c" as []string{"a", "b", "c"}.
+func (ctx *Ctx) ParamPath(name string) ([]string, error) {
+	value, err := ctx.param(name)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	for _, segment := range strings.Split(value, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments, nil
+}
+
+// paramerror records a ParamError, responded to with the status of PARAM_STATUS,
+// 404 by default, or 400 where configured, e.g. EnvItem("param_status:400").
+func paramerror(ctx *Ctx, err *ParamError) error {
+	code, cerr := ctx.App.Env.Store["PARAM_STATUS"].Int()
+	if cerr != nil || (code != 400 && code != 404) {
+		code = 404
+	}
+	ctx.Error(err, err.Name)
+	ctx.Push(func(c *Ctx) { c.Status(code) })
+	return err
+}
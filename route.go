@@ -23,9 +23,11 @@ type (
 		registered    bool
 		blueprint     *Blueprint
 		static        bool
+		sessionless   bool
 		method        string
 		base          string
 		path          string
+		segments      []routeSegment
 		handlers      []HandlerFunc
 		ctxprocessors map[string]interface{}
 		Name          string
@@ -82,14 +84,19 @@ func (rt *Route) CtxFuncs() map[string]interface{} {
 
 func (rt *Route) handle(c context.Context) {
 	rq := rt.getCtx(c.Value("Current").(Current))
-	rq.events()
+	if rt.convert(rq) {
+		rq.events()
+	} else {
+		rq.Status(404)
+	}
 	rt.putCtx(rq)
 }
 
 // NewRoute returns a new Route from a string method, a string path, a boolean
-// indicating if the route is static, and an array of HandlerFunc
+// indicating if the route is static, and an array of HandlerFunc. Static routes
+// do not use sessions.
 func NewRoute(method string, path string, static bool, handlers []HandlerFunc) *Route {
-	rt := &Route{method: method, static: static, handlers: handlers, ctxprocessors: make(map[string]interface{})}
+	rt := &Route{method: method, static: static, sessionless: static, handlers: handlers, ctxprocessors: make(map[string]interface{})}
 	if static {
 		if fp := strings.Split(path, "/"); fp[len(fp)-1] != "*filepath" {
 			rt.base = filepath.ToSlash(filepath.Join(path, "/*filepath"))
@@ -105,7 +112,7 @@ func NewRoute(method string, path string, static bool, handlers []HandlerFunc) *
 // Named produces a default name for the route based on path & parameters, useful
 // to Blueprint and App, where a route is not specifically named.
 func (rt *Route) Named() string {
-	name := strings.Split(rt.path, "/")
+	name := splitPath(rt.path)
 	name = append(name, strings.ToLower(rt.method))
 	for index, value := range name {
 		if regSplat.MatchString(value) {
@@ -120,9 +127,8 @@ func (rt *Route) Named() string {
 
 // Url takes string parameters and applies them to a Route. First to any :parameter
 // params, then *splat params. If any params are left over(not the case with a
-// *splat), and the route method is GET, a query string of key=value is appended
-// to the end of the url with arbitrarily assigned keys(e.g. value1=param) where
-// no key is provided
+// *splat), a query string of key=value is appended to the end of the url with
+// arbitrarily assigned keys(e.g. value1=param) where no key is provided
 //
 // e.g.
 // r1 := NewRoute("GET", /my/:mysterious/path, false, []HandlerFunc{AHandlerFunc})
@@ -136,42 +142,179 @@ func (rt *Route) Named() string {
 // fmt.Printf("url2: %s\n", u2)
 //
 //	/my/hello/world/are/you/there
+//
+// Params of a route pattern with a converter, e.g. /my/:id<int>, are formatted
+// by the converter, returning an error for a param the converter does not match.
 func (rt *Route) Url(params ...string) (*url.URL, error) {
 	paramCount := len(params)
 	i := 0
-	rurl := regParam.ReplaceAllStringFunc(rt.path, func(m string) string {
+	var path []string
+	for _, s := range rt.routeSegments() {
 		var val string
-		if i < paramCount {
-			val = params[i]
-		}
-		i += 1
-		return fmt.Sprintf(`%s`, val)
-	})
-	rurl = regSplat.ReplaceAllStringFunc(rurl, func(m string) string {
-		splat := params[i:(len(params))]
-		i += len(splat)
-		return fmt.Sprintf(strings.Join(splat, "/"))
-	})
-	u, err := url.Parse(rurl)
+		switch s.kind {
+		case ':':
+			if i < paramCount {
+				val = params[i]
+			}
+			i += 1
+		case '*':
+			if i < paramCount {
+				val = strings.Join(params[i:], "/")
+			}
+			i = paramCount
+		default:
+			path = append(path, s.value)
+			continue
+		}
+		if s.converter != nil {
+			formatted, err := s.converter.Format(val)
+			if err != nil {
+				return nil, newError("route %s param %s: %s", rt.path, s.value, err)
+			}
+			val = formatted
+		}
+		path = append(path, val)
+	}
+	u, err := url.Parse(strings.Join(path, "/"))
 	if err != nil {
 		return nil, err
 	}
-	if i < len(params) && rt.method == "GET" {
+	if i < len(params) {
 		providedquerystring := params[i:(len(params))]
 		var querystring []string
-		qsi := 0
 		for qi, qs := range providedquerystring {
-			if len(strings.Split(qs, "=")) != 2 {
-				qs = fmt.Sprintf("value%d=%s", qi+1, qs)
+			key, value := fmt.Sprintf("value%d", qi+1), qs
+			if kv := strings.SplitN(qs, "=", 2); len(kv) == 2 {
+				key, value = kv[0], kv[1]
 			}
-			querystring = append(querystring, url.QueryEscape(qs))
-			qsi += 1
+			querystring = append(querystring, url.QueryEscape(key)+"="+url.QueryEscape(value))
 		}
 		u.RawQuery = strings.Join(querystring, "&")
 	}
 	return u, nil
 }
 
+// UrlParams applies params to a Route by name. Each :param and *splat of the
+// route is required, formatted by any route converter & escaped, where a
+// *splat value may be a []string of path segments. Any other params are
+// encoded as the url query string, e.g.
+//
+// 	r := NewRoute("GET", "/user/:id<int>/*path", false, []HandlerFunc{AHandlerFunc})
+// 	u, _ := r.UrlParams(map[string]interface{}{"id": 7, "path": "a b/c", "q": "x&y"})
+// 	fmt.Printf("url: %s\n", u)
+//
+//	/user/7/a%20b/c?q=x%26y
+func (rt *Route) UrlParams(params map[string]interface{}) (*url.URL, error) {
+	used := make(map[string]bool)
+	var path []string
+	for _, s := range rt.routeSegments() {
+		if s.kind == 0 {
+			path = append(path, s.value)
+			continue
+		}
+		value, ok := params[s.value]
+		if !ok {
+			return nil, newError("route %s requires param %s", rt.path, s.value)
+		}
+		used[s.value] = true
+		val, err := formatParam(s, value)
+		if err != nil {
+			return nil, newError("route %s param %s: %s", rt.path, s.value, err)
+		}
+		if s.kind == '*' {
+			segments := strings.Split(val, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			val = strings.Join(segments, "/")
+		} else {
+			val = url.PathEscape(val)
+		}
+		path = append(path, val)
+	}
+	u, err := url.Parse(strings.Join(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	query := make(url.Values)
+	for key, value := range params {
+		if used[key] {
+			continue
+		}
+		switch v := value.(type) {
+		case []string:
+			query[key] = append(query[key], v...)
+		default:
+			query.Add(key, fmt.Sprint(v))
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// formatParam formats a param value, where a []string, e.g. of url.Values, is
+// the path segments of a *splat, or a single value of a :param.
+func formatParam(s routeSegment, value interface{}) (string, error) {
+	if values, ok := value.([]string); ok {
+		switch {
+		case s.kind == '*':
+			value = strings.Join(values, "/")
+		case len(values) == 1:
+			value = values[0]
+		}
+	}
+	if s.converter != nil {
+		return s.converter.Format(value)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// match returns the :param & *splat values of the request path matched by the
+// route path, or false where the request path does not match.
+func (rt *Route) match(requested string) (map[string]string, bool) {
+	return matchSegments(rt.routeSegments(), requested)
+}
+
+// matchSegments returns the :param & *splat values of the requested path, and
+// whether it matches the pattern segments.
+func matchSegments(pattern []routeSegment, requested string) (map[string]string, bool) {
+	params := make(map[string]string)
+	segments := strings.Split(requested, "/")
+	if len(pattern) > 1 && pattern[len(pattern)-1].kind == 0 && pattern[len(pattern)-1].value == "" {
+		pattern = pattern[:len(pattern)-1]
+	}
+	if len(segments) > 1 && segments[len(segments)-1] == "" {
+		segments = segments[:len(segments)-1]
+	}
+	for i, p := range pattern {
+		switch {
+		case p.kind == '*':
+			if i < len(segments) {
+				params[p.value] = strings.Join(segments[i:], "/")
+			} else {
+				params[p.value] = ""
+			}
+			return params, true
+		case i >= len(segments):
+			return nil, false
+		case p.kind == ':':
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[p.value] = segments[i]
+		case p.value != segments[i]:
+			return nil, false
+		}
+	}
+	return params, len(pattern) == len(segments)
+}
+
+// DisableSessions opts the Route out of sessions. Ctx.Session in its handlers
+// holds nothing, and returns ErrSessionDisabled for any change.
+func (rt *Route) DisableSessions() {
+	rt.sessionless = true
+}
+
 func (rt *Route) CtxProcessor(name string, fn interface{}) {
 	rt.ctxprocessors[name] = fn
 }
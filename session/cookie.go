@@ -5,13 +5,14 @@ import (
 	"crypto/cipher"
 
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"sync"
 )
 
 var (
-	cookiepder = &CookieProvider{}
+	cookiepder = NewCookieProvider()
 )
 
 type (
@@ -19,21 +20,30 @@ type (
 		sid    string
 		values map[interface{}]interface{} // session data
 		lock   sync.RWMutex
+		pder   *CookieProvider
 	}
 
+	// CookieProvider encodes sessions into a client cookie. Each instance holds
+	// its own block cipher, hash key and cookie settings.
 	CookieProvider struct {
 		maxlifetime int64
 		config      *cookieConfig
 		block       cipher.Block
+		ring        keyRing
+		serializer  Serializer
 	}
 
 	cookieConfig struct {
-		SecurityKey  string `json:"securityKey"`
-		BlockKey     string `json:"blockKey"`
-		SecurityName string `json:"securityName"`
-		CookieName   string `json:"cookieName"`
-		Secure       bool   `json:"secure"`
-		Maxage       int    `json:"maxage"`
+		SecurityKey  string   `json:"securityKey"`
+		BlockKey     string   `json:"blockKey"`
+		SecurityName string   `json:"securityName"`
+		CookieName   string   `json:"cookieName"`
+		Secure       bool     `json:"secure"`
+		Maxage       int      `json:"maxage"`
+		Keys         []string `json:"keys"`
+		Cipher       string   `json:"cipher"`
+		Serializer   string   `json:"serializer"`
+		Legacy       bool     `json:"legacy"`
 	}
 )
 
@@ -73,6 +83,16 @@ func (st *CookieSessionStore) Flush() error {
 	return nil
 }
 
+func (st *CookieSessionStore) sessionValues() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
+}
+
 // Return id of this cookie session
 func (st *CookieSessionStore) SessionID() string {
 	return st.sid
@@ -80,23 +100,31 @@ func (st *CookieSessionStore) SessionID() string {
 
 // Write cookie session to http response cookie
 func (st *CookieSessionStore) SessionRelease(w http.ResponseWriter) {
-	str, err := encodeCookie(cookiepder.block,
-		cookiepder.config.SecurityKey,
-		cookiepder.config.SecurityName,
-		st.values)
+	st.lock.RLock()
+	str, err := st.pder.encode(st.values)
+	st.lock.RUnlock()
 	if err != nil {
 		return
 	}
-	cookie := &http.Cookie{Name: cookiepder.config.CookieName,
+	cookie := &http.Cookie{Name: st.pder.config.CookieName,
 		Value:    url.QueryEscape(str),
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   cookiepder.config.Secure,
-		MaxAge:   cookiepder.config.Maxage}
-	http.SetCookie(w, cookie)
+		Secure:   st.pder.config.Secure,
+		MaxAge:   st.pder.config.Maxage}
+	setCookie(w, cookie)
 	return
 }
 
+// NewCookieProvider returns an uninitialized CookieProvider.
+func NewCookieProvider() *CookieProvider {
+	return &CookieProvider{}
+}
+
+func (pder *CookieProvider) instance() Provider {
+	return NewCookieProvider()
+}
+
 // Init cookie session provider with max lifetime and config json.
 // maxlifetime is ignored.
 // json config:
@@ -105,6 +133,12 @@ func (st *CookieSessionStore) SessionRelease(w http.ResponseWriter) {
 // 	securityName - recognized name in encoded cookie string
 // 	cookieName - cookie name
 // 	maxage - cookie max life time.
+// 	keys - key ring of secrets for AES-GCM, the first encodes & all decode.
+// 	cipher - "gcm"(default when keys are provided) or "ctr".
+// 	serializer - registered Serializer name, "gob"(default) or "json".
+// 	legacy - with "gcm", also decode cookies of the "ctr" cipher, while
+// 	migrating. A released session is always encoded with "gcm", so a legacy
+// 	cookie read & released is re-issued as a "gcm" cookie.
 func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error {
 	pder.config = &cookieConfig{}
 	err := json.Unmarshal([]byte(config), pder.config)
@@ -121,6 +155,21 @@ func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error
 	if err != nil {
 		return err
 	}
+	if pder.serializer, err = getSerializer(pder.config.Serializer); err != nil {
+		return err
+	}
+	if pder.config.Cipher == "" && len(pder.config.Keys) > 0 {
+		pder.config.Cipher = "gcm"
+	}
+	switch pder.config.Cipher {
+	case "gcm":
+		if pder.ring, err = newKeyRing(pder.config.Keys...); err != nil {
+			return err
+		}
+	case "", "ctr":
+	default:
+		return fmt.Errorf("session: unknown cookie cipher %q", pder.config.Cipher)
+	}
 	pder.maxlifetime = maxlifetime
 	return nil
 }
@@ -128,25 +177,56 @@ func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error
 // Get SessionStore in cooke.
 // decode cookie string to map and put into SessionStore with sid.
 func (pder *CookieProvider) SessionRead(sid string) (SessionStore, error) {
-	maps, _ := decodeCookie(pder.block,
-		pder.config.SecurityKey,
-		pder.config.SecurityName,
-		sid, pder.maxlifetime)
+	maps, _ := pder.decode(sid)
 	if maps == nil {
 		maps = make(map[interface{}]interface{})
 	}
-	rs := &CookieSessionStore{sid: sid, values: maps}
+	rs := &CookieSessionStore{sid: sid, values: maps, pder: pder}
 	return rs, nil
 }
 
+// encode session values with the key ring when using AES-GCM, or the block
+// cipher and security key otherwise.
+func (pder *CookieProvider) encode(values map[interface{}]interface{}) (string, error) {
+	if pder.ring != nil {
+		return encodeCookieAEAD(pder.serializer, pder.ring, pder.config.CookieName, values)
+	}
+	return encodeCookie(pder.serializer, pder.block,
+		pder.config.SecurityKey,
+		pder.config.SecurityName,
+		values)
+}
+
+// decode a cookie value with the key ring when using AES-GCM, or the block
+// cipher and security key otherwise. With legacy configured, a value not
+// decoded with the key ring falls back to the block cipher and security key,
+// so cookies set before switching to AES-GCM remain readable.
+func (pder *CookieProvider) decode(value string) (map[interface{}]interface{}, error) {
+	if pder.ring != nil {
+		maps, err := decodeCookieAEAD(pder.serializer, pder.ring, pder.config.CookieName, value, pder.maxlifetime)
+		if err == nil || !pder.config.Legacy {
+			return maps, err
+		}
+	}
+	return decodeCookie(pder.serializer, pder.block,
+		pder.config.SecurityKey,
+		pder.config.SecurityName,
+		value, pder.maxlifetime)
+}
+
 // Cookie session is always existed
 func (pder *CookieProvider) SessionExist(sid string) bool {
 	return true
 }
 
-// Method not implemented.
+// Decode the cookie value of oldsid into a SessionStore for sid. The cookie
+// holds the session data, so the old value can not be invalidated server-side.
 func (pder *CookieProvider) SessionRegenerate(oldsid, sid string) (SessionStore, error) {
-	return nil, nil
+	maps, _ := pder.decode(oldsid)
+	if maps == nil {
+		maps = make(map[interface{}]interface{})
+	}
+	return &CookieSessionStore{sid: sid, values: maps, pder: pder}, nil
 }
 
 // Method not implemented.
@@ -0,0 +1,370 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	filepder = NewFileProvider()
+)
+
+// The number of locks access to session files is serialized by, each shared
+// by the sids hashing to it.
+const sidLockStripes = 64
+
+type (
+	// FileSessionStore is a SessionStore saved as a single file per sid in
+	// the directory of a FileProvider.
+	FileSessionStore struct {
+		sid    string
+		values map[interface{}]interface{} // session data
+		lock   sync.RWMutex
+		pder   *FileProvider
+	}
+
+	// FileProvider stores sessions as files under a configured directory,
+	// writing each file atomically and serializing access per sid, with a
+	// fixed set of locks striped by sid.
+	FileProvider struct {
+		sidlocks    [sidLockStripes]sync.Mutex
+		maxlifetime int64
+		config      *fileConfig
+		serializer  Serializer
+	}
+
+	fileConfig struct {
+		Path       string `json:"path"`
+		Serializer string `json:"serializer"`
+	}
+)
+
+// Set value in file session.
+func (st *FileSessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	return nil
+}
+
+// Get value from file session.
+func (st *FileSessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in file session.
+func (st *FileSessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	return nil
+}
+
+// Clean all values in file session.
+func (st *FileSessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+func (st *FileSessionStore) sessionValues() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Return id of this file session.
+func (st *FileSessionStore) SessionID() string {
+	return st.sid
+}
+
+// Write file session data to the provider directory. SessionRelease returns
+// nothing, so a failed write is logged.
+func (st *FileSessionStore) SessionRelease(w http.ResponseWriter) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if err := st.pder.write(st.sid, st.values); err != nil {
+		log.Printf("session: file provider could not save session %s: %v", st.sid, err)
+	}
+}
+
+// NewFileProvider returns a FileProvider with no directory configured.
+func NewFileProvider() *FileProvider {
+	return &FileProvider{}
+}
+
+func (pder *FileProvider) instance() Provider {
+	return NewFileProvider()
+}
+
+// Init file session provider with max lifetime and config json.
+// json config:
+// 	path - directory session files are saved in, created if it does not exist
+// 	serializer - registered Serializer name, "gob"(default) or "json".
+func (pder *FileProvider) SessionInit(maxlifetime int64, config string) error {
+	pder.config = &fileConfig{}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), pder.config); err != nil {
+			return err
+		}
+	}
+	if pder.config.Path == "" {
+		return errors.New("session: file provider requires a path")
+	}
+	serializer, err := getSerializer(pder.config.Serializer)
+	if err != nil {
+		return err
+	}
+	pder.serializer = serializer
+	if err := os.MkdirAll(pder.config.Path, 0700); err != nil {
+		return err
+	}
+	pder.maxlifetime = maxlifetime
+	return nil
+}
+
+// Return the stripe of the sid hash.
+func sidstripe(sid string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(sid))
+	return h.Sum32() % sidLockStripes
+}
+
+// Return the lock for a sid, the stripe of the sid hash.
+func (pder *FileProvider) sidlock(sid string) *sync.Mutex {
+	return &pder.sidlocks[sidstripe(sid)]
+}
+
+// Lock the stripes of two sids, in stripe order so concurrent callers cannot
+// deadlock, returning the func unlocking both.
+func (pder *FileProvider) sidlocks2(a, b string) func() {
+	sa, sb := sidstripe(a), sidstripe(b)
+	if sa == sb {
+		pder.sidlocks[sa].Lock()
+		return pder.sidlocks[sa].Unlock
+	}
+	if sa > sb {
+		sa, sb = sb, sa
+	}
+	pder.sidlocks[sa].Lock()
+	pder.sidlocks[sb].Lock()
+	return func() {
+		pder.sidlocks[sb].Unlock()
+		pder.sidlocks[sa].Unlock()
+	}
+}
+
+// validSid guards against sids, which arrive from a request cookie, naming
+// files outside the provider directory.
+func validSid(sid string) bool {
+	if sid == "" {
+		return false
+	}
+	for _, r := range sid {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (pder *FileProvider) filename(sid string) string {
+	return filepath.Join(pder.config.Path, sid)
+}
+
+// expired reports whether a session file was not modified within maxlifetime,
+// as collected by SessionGC.
+func (pder *FileProvider) expired(fi os.FileInfo) bool {
+	return fi.ModTime().Unix() <= time.Now().Unix()-pder.maxlifetime
+}
+
+// read returns the values of the session file for sid, touching the file. An
+// expired file is removed and read as not existing, rather than revived.
+func (pder *FileProvider) read(sid string) (map[interface{}]interface{}, error) {
+	fi, err := os.Stat(pder.filename(sid))
+	if err != nil {
+		return nil, err
+	}
+	if pder.expired(fi) {
+		os.Remove(pder.filename(sid))
+		return nil, os.ErrNotExist
+	}
+	b, err := ioutil.ReadFile(pder.filename(sid))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(pder.filename(sid), now, now)
+	if len(b) == 0 {
+		return make(map[interface{}]interface{}), nil
+	}
+	return pder.serializer.Decode(b)
+}
+
+// write encodes values to a temporary file in the provider directory, and
+// renames it over the session file so readers never see a partial write.
+func (pder *FileProvider) write(sid string, values map[interface{}]interface{}) error {
+	if !validSid(sid) {
+		return errors.New("session: invalid sid")
+	}
+	b, err := pder.serializer.Encode(values)
+	if err != nil {
+		return err
+	}
+	l := pder.sidlock(sid)
+	l.Lock()
+	defer l.Unlock()
+	tmp, err := ioutil.TempFile(pder.config.Path, "."+sid)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), pder.filename(sid))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Get SessionStore from its file, or a new empty SessionStore if sid has no
+// file yet.
+func (pder *FileProvider) SessionRead(sid string) (SessionStore, error) {
+	if !validSid(sid) {
+		return nil, errors.New("session: invalid sid")
+	}
+	l := pder.sidlock(sid)
+	l.Lock()
+	defer l.Unlock()
+	return pder.store(sid)
+}
+
+// store returns the SessionStore for sid, empty where sid has no file or its
+// file expired. The caller holds the lock of sid.
+func (pder *FileProvider) store(sid string) (SessionStore, error) {
+	values, err := pder.read(sid)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		values = make(map[interface{}]interface{})
+	}
+	return &FileSessionStore{sid: sid, values: values, pder: pder}, nil
+}
+
+// Check file session exists by sid, and has not expired.
+func (pder *FileProvider) SessionExist(sid string) bool {
+	if !validSid(sid) {
+		return false
+	}
+	fi, err := os.Stat(pder.filename(sid))
+	return err == nil && !pder.expired(fi)
+}
+
+// Move the session file for oldsid to sid, returning the SessionStore for sid.
+// An expired oldsid file is removed, not moved.
+func (pder *FileProvider) SessionRegenerate(oldsid, sid string) (SessionStore, error) {
+	if !validSid(oldsid) || !validSid(sid) {
+		return nil, errors.New("session: invalid sid")
+	}
+	unlock := pder.sidlocks2(oldsid, sid)
+	defer unlock()
+	fi, err := os.Stat(pder.filename(oldsid))
+	switch {
+	case err == nil && pder.expired(fi):
+		err = os.Remove(pder.filename(oldsid))
+	case err == nil:
+		err = os.Rename(pder.filename(oldsid), pder.filename(sid))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return pder.store(sid)
+}
+
+// Remove the session file for sid.
+func (pder *FileProvider) SessionDestroy(sid string) error {
+	if !validSid(sid) {
+		return nil
+	}
+	l := pder.sidlock(sid)
+	l.Lock()
+	err := os.Remove(pder.filename(sid))
+	l.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Remove session files not modified within maxlifetime.
+func (pder *FileProvider) SessionGC() {
+	files, err := ioutil.ReadDir(pder.config.Path)
+	if err != nil {
+		return
+	}
+	expired := time.Now().Unix() - pder.maxlifetime
+	for _, f := range files {
+		if f.IsDir() || f.ModTime().Unix() > expired {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), ".") {
+			os.Remove(filepath.Join(pder.config.Path, f.Name()))
+			continue
+		}
+		pder.SessionDestroy(f.Name())
+	}
+}
+
+// Return the count of session files.
+func (pder *FileProvider) SessionAll() int {
+	files, err := ioutil.ReadDir(pder.config.Path)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, f := range files {
+		if !f.IsDir() && validSid(f.Name()) {
+			count++
+		}
+	}
+	return count
+}
+
+// Update the modification time of a session file by sid.
+func (pder *FileProvider) SessionUpdate(sid string) error {
+	if !validSid(sid) {
+		return errors.New("session: invalid sid")
+	}
+	now := time.Now()
+	return os.Chtimes(pder.filename(sid), now, now)
+}
+
+func init() {
+	Register("file", filepder)
+}
@@ -0,0 +1,226 @@
+package session
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	mempder = NewMemoryProvider()
+)
+
+type (
+	// MemorySessionStore is a SessionStore whose data is held server-side in
+	// the memory of the running process.
+	MemorySessionStore struct {
+		sid          string
+		timeAccessed time.Time
+		values       map[interface{}]interface{} // session data
+		lock         sync.RWMutex
+	}
+
+	// MemoryProvider keeps MemorySessionStores keyed by sid, ordered by most
+	// recent access so expired sessions can be collected from the back.
+	MemoryProvider struct {
+		lock        sync.RWMutex
+		sessions    map[string]*list.Element
+		list        *list.List
+		maxlifetime int64
+	}
+)
+
+// Set value in memory session.
+func (st *MemorySessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	return nil
+}
+
+// Get value from memory session.
+func (st *MemorySessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in memory session.
+func (st *MemorySessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	return nil
+}
+
+// Clean all values in memory session.
+func (st *MemorySessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+func (st *MemorySessionStore) sessionValues() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Return id of this memory session.
+func (st *MemorySessionStore) SessionID() string {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.sid
+}
+
+// Memory session data is kept by the provider, nothing is written to the
+// response.
+func (st *MemorySessionStore) SessionRelease(w http.ResponseWriter) {
+}
+
+// NewMemoryProvider returns an empty MemoryProvider.
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{
+		sessions: make(map[string]*list.Element),
+		list:     list.New(),
+	}
+}
+
+func (pder *MemoryProvider) instance() Provider {
+	return NewMemoryProvider()
+}
+
+// Init memory session provider with max lifetime. config is ignored.
+func (pder *MemoryProvider) SessionInit(maxlifetime int64, config string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	pder.maxlifetime = maxlifetime
+	return nil
+}
+
+func (pder *MemoryProvider) newStore(sid string) *list.Element {
+	st := &MemorySessionStore{sid: sid,
+		timeAccessed: time.Now(),
+		values:       make(map[interface{}]interface{})}
+	element := pder.list.PushFront(st)
+	pder.sessions[sid] = element
+	return element
+}
+
+func (pder *MemoryProvider) touch(element *list.Element) *MemorySessionStore {
+	st := element.Value.(*MemorySessionStore)
+	st.timeAccessed = time.Now()
+	pder.list.MoveToFront(element)
+	return st
+}
+
+// expired reports whether the session was last accessed longer than
+// maxlifetime ago, as collected by SessionGC.
+func (pder *MemoryProvider) expired(element *list.Element) bool {
+	st := element.Value.(*MemorySessionStore)
+	return st.timeAccessed.Unix() <= time.Now().Unix()-pder.maxlifetime
+}
+
+// live returns the element of sid where it exists and has not expired,
+// removing an expired session.
+func (pder *MemoryProvider) live(sid string) (*list.Element, bool) {
+	element, ok := pder.sessions[sid]
+	if ok && pder.expired(element) {
+		delete(pder.sessions, sid)
+		pder.list.Remove(element)
+		return nil, false
+	}
+	return element, ok
+}
+
+// Get SessionStore in memory, creating a new one if sid does not exist or has
+// expired.
+func (pder *MemoryProvider) SessionRead(sid string) (SessionStore, error) {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.live(sid); ok {
+		return pder.touch(element), nil
+	}
+	return pder.newStore(sid).Value.(*MemorySessionStore), nil
+}
+
+// Check memory session exists by sid, and has not expired.
+func (pder *MemoryProvider) SessionExist(sid string) bool {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	element, ok := pder.sessions[sid]
+	return ok && !pder.expired(element)
+}
+
+// Move the data stored under oldsid to sid. If oldsid does not exist or has
+// expired, a new empty session is created for sid.
+func (pder *MemoryProvider) SessionRegenerate(oldsid, sid string) (SessionStore, error) {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.live(oldsid); ok {
+		delete(pder.sessions, oldsid)
+		st := pder.touch(element)
+		st.lock.Lock()
+		st.sid = sid
+		st.lock.Unlock()
+		pder.sessions[sid] = element
+		return st, nil
+	}
+	return pder.newStore(sid).Value.(*MemorySessionStore), nil
+}
+
+// Delete memory session by sid.
+func (pder *MemoryProvider) SessionDestroy(sid string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.sessions[sid]; ok {
+		delete(pder.sessions, sid)
+		pder.list.Remove(element)
+	}
+	return nil
+}
+
+// Remove all sessions not accessed within maxlifetime.
+func (pder *MemoryProvider) SessionGC() {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	expired := time.Now().Unix() - pder.maxlifetime
+	for element := pder.list.Back(); element != nil; element = pder.list.Back() {
+		st := element.Value.(*MemorySessionStore)
+		if st.timeAccessed.Unix() > expired {
+			return
+		}
+		pder.list.Remove(element)
+		delete(pder.sessions, st.sid)
+	}
+}
+
+// Return the count of active memory sessions.
+func (pder *MemoryProvider) SessionAll() int {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	return pder.list.Len()
+}
+
+// Update the access time of a memory session by sid.
+func (pder *MemoryProvider) SessionUpdate(sid string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.sessions[sid]; ok {
+		pder.touch(element)
+	}
+	return nil
+}
+
+func init() {
+	Register("memory", mempder)
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	serializers = map[string]Serializer{
+		"gob":  GobSerializer{},
+		"json": NewJSONSerializer(),
+	}
+)
+
+type (
+	// Serializer encodes & decodes session values for providers that store
+	// sessions outside of process memory.
+	Serializer interface {
+		Encode(map[interface{}]interface{}) ([]byte, error)
+		Decode([]byte) (map[interface{}]interface{}, error)
+	}
+
+	// GobSerializer encodes session values with encoding/gob. Custom value
+	// types must be registered with gob.Register.
+	GobSerializer struct{}
+
+	// JSONSerializer encodes session values as a JSON object readable by other
+	// services. Keys must be strings, and each value is stored with the name
+	// of its registered type so that it decodes to the same Go type.
+	JSONSerializer struct {
+		lock  sync.RWMutex
+		types map[string]reflect.Type
+		names map[reflect.Type]string
+	}
+
+	jsonValue struct {
+		Type  string          `json:"t"`
+		Value json.RawMessage `json:"v"`
+	}
+)
+
+// RegisterSerializer makes a Serializer available to providers by the provided
+// name, replacing any existing Serializer of the same name.
+func RegisterSerializer(name string, s Serializer) {
+	if s == nil {
+		panic("session: RegisterSerializer serializer is nil")
+	}
+	serializers[name] = s
+}
+
+// RegisterJSONType registers the type of value by name with the default "json"
+// Serializer.
+func RegisterJSONType(name string, value interface{}) {
+	if s, ok := serializers["json"].(*JSONSerializer); ok {
+		s.Register(name, value)
+	}
+}
+
+// getSerializer returns the named Serializer, gob if name is empty.
+func getSerializer(name string) (Serializer, error) {
+	if name == "" {
+		name = "gob"
+	}
+	if s, ok := serializers[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("session: unknown serializer: %q", name)
+}
+
+func (s GobSerializer) Encode(values map[interface{}]interface{}) ([]byte, error) {
+	return EncodeGob(values)
+}
+
+func (s GobSerializer) Decode(b []byte) (map[interface{}]interface{}, error) {
+	return DecodeGob(b)
+}
+
+// NewJSONSerializer returns a JSONSerializer with common builtin types
+// registered.
+func NewJSONSerializer() *JSONSerializer {
+	s := &JSONSerializer{
+		types: make(map[string]reflect.Type),
+		names: make(map[reflect.Type]string),
+	}
+	s.Register("string", "")
+	s.Register("bool", false)
+	s.Register("int", int(0))
+	s.Register("int64", int64(0))
+	s.Register("float64", float64(0))
+	s.Register("[]string", []string{})
+	s.Register("[]interface{}", []interface{}{})
+	s.Register("map[string]string", map[string]string{})
+	s.Register("map[string]interface{}", map[string]interface{}{})
+	return s
+}
+
+// Register makes the type of value encodable by the JSONSerializer under name.
+func (s *JSONSerializer) Register(name string, value interface{}) {
+	typ := reflect.TypeOf(value)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.types[name] = typ
+	s.names[typ] = name
+}
+
+func (s *JSONSerializer) Encode(values map[interface{}]interface{}) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	out := make(map[string]jsonValue, len(values))
+	for k, v := range values {
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("session: json serializer: key %v is %T, not string", k, k)
+		}
+		name, ok := s.names[reflect.TypeOf(v)]
+		if !ok {
+			return nil, fmt.Errorf("session: json serializer: type %T of key %q is not registered", v, key)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = jsonValue{name, b}
+	}
+	return json.Marshal(out)
+}
+
+func (s *JSONSerializer) Decode(b []byte) (map[interface{}]interface{}, error) {
+	var in map[string]jsonValue
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(in))
+	for key, jv := range in {
+		typ, ok := s.types[jv.Type]
+		if !ok {
+			return nil, fmt.Errorf("session: json serializer: unknown type %q for key %q", jv.Type, key)
+		}
+		v := reflect.New(typ)
+		if err := json.Unmarshal(jv.Value, v.Interface()); err != nil {
+			return nil, fmt.Errorf("session: json serializer: key %q: %s", key, err)
+		}
+		values[key] = v.Elem().Interface()
+	}
+	return values, nil
+}
@@ -8,10 +8,12 @@ import (
 
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -42,6 +44,18 @@ type (
 		SessionGC()
 	}
 
+	// valuer is implemented by the builtin session stores, returning a copy of
+	// their values.
+	valuer interface {
+		sessionValues() map[interface{}]interface{}
+	}
+
+	// instancer is implemented by the builtin providers, so each Manager made
+	// from a registered name receives a provider instance of its own.
+	instancer interface {
+		instance() Provider
+	}
+
 	// Manager contains Provider and its configuration.
 	Manager struct {
 		provider Provider
@@ -75,13 +89,28 @@ func Register(name string, provide Provider) {
 	provides[name] = provide
 }
 
-// Create new Manager with provider name and json config string
-// where provider is an existing valid provider(e.g. "cookie") and a
-// json config.
-func NewManager(provideName, config string) (*Manager, error) {
-	provider, ok := provides[provideName]
-	if !ok {
-		return nil, fmt.Errorf("session: unknown provide: %q (forgotten import?)", provideName)
+// Create new Manager with a provider and json config string, where provider
+// is either the name of an existing valid provider(e.g. "cookie") or a Provider
+// instance used by this Manager alone.
+func NewManager(provide interface{}, config string) (*Manager, error) {
+	var provider Provider
+	switch p := provide.(type) {
+	case string:
+		registered, ok := provides[p]
+		if !ok {
+			return nil, fmt.Errorf("session: unknown provide: %q (forgotten import?)", p)
+		}
+		provider = registered
+		if i, ok := registered.(instancer); ok {
+			provider = i.instance()
+		}
+	case Provider:
+		if p == nil {
+			return nil, errors.New("session: provide is nil")
+		}
+		provider = p
+	default:
+		return nil, fmt.Errorf("session: provide must be a provider name or a Provider, not %T", provide)
 	}
 	cf := new(managerConfig)
 	cf.EnableSetCookie = true
@@ -115,7 +144,7 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 	cookie, err := r.Cookie(manager.config.CookieName)
 	if err != nil || cookie.Value == "" {
 		sid := manager.sessionId(r)
-		session, _ = manager.provider.SessionRead(sid)
+		session = manager.read(sid)
 		cookie = &http.Cookie{Name: manager.config.CookieName,
 			Value:    url.QueryEscape(sid),
 			Path:     "/",
@@ -126,16 +155,16 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 			cookie.MaxAge = manager.config.CookieLifeTime
 		}
 		if manager.config.EnableSetCookie {
-			http.SetCookie(w, cookie)
+			setCookie(w, cookie)
 		}
 		r.AddCookie(cookie)
 	} else {
 		sid, _ := url.QueryUnescape(cookie.Value)
 		if manager.provider.SessionExist(sid) {
-			session, _ = manager.provider.SessionRead(sid)
+			session = manager.read(sid)
 		} else {
 			sid = manager.sessionId(r)
-			session, _ = manager.provider.SessionRead(sid)
+			session = manager.read(sid)
 			cookie = &http.Cookie{Name: manager.config.CookieName,
 				Value:    url.QueryEscape(sid),
 				Path:     "/",
@@ -146,7 +175,7 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 				cookie.MaxAge = manager.config.CookieLifeTime
 			}
 			if manager.config.EnableSetCookie {
-				http.SetCookie(w, cookie)
+				setCookie(w, cookie)
 			}
 			r.AddCookie(cookie)
 		}
@@ -154,6 +183,46 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 	return
 }
 
+// read returns the SessionStore of sid from the provider. Where the provider
+// cannot read it, e.g. on a database error, the returned SessionStore holds
+// nothing and returns the read error for any change, in place of a nil
+// SessionStore.
+func (manager *Manager) read(sid string) SessionStore {
+	session, err := manager.provider.SessionRead(sid)
+	if err == nil && session == nil {
+		err = errors.New("session: provider read no session")
+	}
+	if err != nil {
+		return &unreadStore{sid: sid, err: err}
+	}
+	return session
+}
+
+// unreadStore is the SessionStore of a session its provider could not read.
+type unreadStore struct {
+	sid string
+	err error
+}
+
+func (st *unreadStore) Set(key, value interface{}) error { return st.err }
+
+func (st *unreadStore) Get(key interface{}) interface{} { return nil }
+
+func (st *unreadStore) Delete(key interface{}) error { return st.err }
+
+func (st *unreadStore) SessionID() string { return st.sid }
+
+func (st *unreadStore) SessionRelease(w http.ResponseWriter) {}
+
+func (st *unreadStore) Flush() error { return st.err }
+
+// HasSession reports whether the http request carries a session cookie, without
+// starting the session.
+func (manager *Manager) HasSession(r *http.Request) bool {
+	cookie, err := r.Cookie(manager.config.CookieName)
+	return err == nil && cookie.Value != ""
+}
+
 // Destroy session by its id in http request cookie.
 func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(manager.config.CookieName)
@@ -167,7 +236,7 @@ func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 			HttpOnly: true,
 			Expires:  expiration,
 			MaxAge:   -1}
-		http.SetCookie(w, &cookie)
+		setCookie(w, &cookie)
 	}
 }
 
@@ -185,32 +254,79 @@ func (manager *Manager) GC() {
 }
 
 // Regenerate a session id for this SessionStore who's id is saving in http request.
+// Server-side providers move the data of the old id to the new id, and the old
+// id is no longer valid.
 func (manager *Manager) SessionRegenerateId(w http.ResponseWriter, r *http.Request) (session SessionStore) {
 	sid := manager.sessionId(r)
 	cookie, err := r.Cookie(manager.config.CookieName)
-	if err != nil && cookie.Value == "" {
-		//delete old cookie
-		session, _ = manager.provider.SessionRead(sid)
-		cookie = &http.Cookie{Name: manager.config.CookieName,
-			Value:    url.QueryEscape(sid),
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   manager.config.Secure,
-			Domain:   manager.config.Domain,
-		}
+	if err != nil || cookie.Value == "" {
+		session = manager.read(sid)
 	} else {
 		oldsid, _ := url.QueryUnescape(cookie.Value)
-		session, _ = manager.provider.SessionRegenerate(oldsid, sid)
-		cookie.Value = url.QueryEscape(sid)
-		cookie.HttpOnly = true
-		cookie.Path = "/"
+		session, err = manager.provider.SessionRegenerate(oldsid, sid)
+		if err != nil || session == nil {
+			session = manager.read(sid)
+		}
+	}
+	cookie = &http.Cookie{Name: manager.config.CookieName,
+		Value:    url.QueryEscape(sid),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   manager.config.Secure,
+		Domain:   manager.config.Domain,
 	}
 	if manager.config.CookieLifeTime >= 0 {
 		cookie.MaxAge = manager.config.CookieLifeTime
 	}
+	if manager.config.EnableSetCookie {
+		setCookie(w, cookie)
+	}
+	replaceCookie(r, cookie)
+	return
+}
+
+// SessionRegenerate regenerates the session id as SessionRegenerateId, and
+// carries the values of the current SessionStore, including any not yet
+// released, over to the returned SessionStore.
+func (manager *Manager) SessionRegenerate(w http.ResponseWriter, r *http.Request, current SessionStore) SessionStore {
+	session := manager.SessionRegenerateId(w, r)
+	if c, ok := current.(valuer); ok && session != current {
+		for k, v := range c.sessionValues() {
+			session.Set(k, v)
+		}
+	}
+	return session
+}
+
+// setCookie sets cookie on the response in place of any Set-Cookie headers for
+// a cookie of the same name, so a response sets a cookie once, e.g. a session
+// id regenerated after the session was started.
+func setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	header := w.Header()
+	var kept []string
+	for _, set := range header["Set-Cookie"] {
+		if name := strings.TrimSpace(strings.SplitN(set, "=", 2)[0]); name != cookie.Name {
+			kept = append(kept, set)
+		}
+	}
+	header.Del("Set-Cookie")
+	for _, set := range kept {
+		header.Add("Set-Cookie", set)
+	}
 	http.SetCookie(w, cookie)
+}
+
+// replaceCookie sets cookie on the request in place of any cookies of the same
+// name, so later reads in the request see the current session id.
+func replaceCookie(r *http.Request, cookie *http.Cookie) {
+	existing := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range existing {
+		if c.Name != cookie.Name {
+			r.AddCookie(c)
+		}
+	}
 	r.AddCookie(cookie)
-	return
 }
 
 // Get all active sessions count number.
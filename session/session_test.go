@@ -1,12 +1,24 @@
 package session
 
 import (
+	"bytes"
 	"crypto/aes"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type User struct {
@@ -32,12 +44,12 @@ func TestCookieEncodeDecode(t *testing.T) {
 	val := make(map[interface{}]interface{})
 	val["tag"] = "hello"
 	val["color"] = "blue"
-	str, err := encodeCookie(block, hashKey, securityName, val)
+	str, err := encodeCookie(GobSerializer{}, block, hashKey, securityName, val)
 	if err != nil {
 		t.Fatal("encodeCookie:", err)
 	}
 	dst := make(map[interface{}]interface{})
-	dst, err = decodeCookie(block, hashKey, securityName, str, 3600)
+	dst, err = decodeCookie(GobSerializer{}, block, hashKey, securityName, str, 3600)
 	if err != nil {
 		t.Fatal("decodeCookie", err)
 	}
@@ -122,3 +134,611 @@ func TestCookie(t *testing.T) {
 		}
 	}
 }
+
+func TestMemory(t *testing.T) {
+	config := `{"cookieName":"gosessionid","gclifetime":3600}`
+	globalSessions, err := NewManager("memory", config)
+	if err != nil {
+		t.Fatal("init memory session err", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess := globalSessions.SessionStart(w, r)
+	sess.Set("username", "Special Agent Fox Mulder")
+	cookie, err := r.Cookie("gosessionid")
+	if err != nil || cookie.Value == "" {
+		t.Fatal("memory session cookie not set")
+	}
+	r2, _ := http.NewRequest("GET", "/", nil)
+	r2.AddCookie(cookie)
+	sess2 := globalSessions.SessionStart(httptest.NewRecorder(), r2)
+	if username := sess2.Get("username"); username != "Special Agent Fox Mulder" {
+		t.Fatal("memory session data was not kept by sid")
+	}
+	if globalSessions.GetActiveSession() < 1 {
+		t.Fatal("memory session was not counted as active")
+	}
+}
+
+// TestMemoryRegenerateRace reads the sid of a session while it is regenerated,
+// for the race detector.
+func TestMemoryRegenerateRace(t *testing.T) {
+	pder := NewMemoryProvider()
+	pder.SessionInit(3600, "")
+	sess, _ := pder.SessionRead("sid0")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			pder.SessionRegenerate(fmt.Sprintf("sid%d", i), fmt.Sprintf("sid%d", i+1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			sess.SessionID()
+		}
+	}()
+	wg.Wait()
+	if sid := sess.SessionID(); sid != "sid100" {
+		t.Fatalf("memory session sid was %s after regenerating", sid)
+	}
+}
+
+func TestMemoryProvider(t *testing.T) {
+	pder := NewMemoryProvider()
+	pder.SessionInit(3600, "")
+	sess, _ := pder.SessionRead("oldsid")
+	sess.Set("tag", "hello")
+	regen, _ := pder.SessionRegenerate("oldsid", "newsid")
+	if regen.SessionID() != "newsid" || regen.Get("tag") != "hello" {
+		t.Fatal("memory session regenerate did not keep data")
+	}
+	if pder.SessionExist("oldsid") {
+		t.Fatal("memory session regenerate kept old sid")
+	}
+	pder.SessionRead("othersid")
+	if pder.SessionAll() != 2 {
+		t.Fatal("memory session count error")
+	}
+	pder.SessionDestroy("othersid")
+	if pder.SessionExist("othersid") || pder.SessionAll() != 1 {
+		t.Fatal("memory session destroy error")
+	}
+	pder.maxlifetime = -1
+	if pder.SessionExist("newsid") {
+		t.Fatal("memory session exists after expiry")
+	}
+	if sess, _ := pder.SessionRead("newsid"); sess.Get("tag") != nil {
+		t.Fatal("memory session read revived an expired session")
+	}
+	pder.SessionGC()
+	if pder.SessionAll() != 0 {
+		t.Fatal("memory session gc did not remove expired sessions")
+	}
+}
+
+func TestMemoryConcurrent(t *testing.T) {
+	pder := NewMemoryProvider()
+	pder.SessionInit(3600, "")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sid := fmt.Sprintf("sid%d", i%5)
+			sess, _ := pder.SessionRead(sid)
+			sess.Set(i, i)
+			sess.Get(i)
+			pder.SessionGC()
+			pder.SessionAll()
+		}(i)
+	}
+	wg.Wait()
+	if pder.SessionAll() != 5 {
+		t.Fatal("memory session count error under concurrent access")
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flotilla-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pder := NewFileProvider()
+	if err := pder.SessionInit(3600, fmt.Sprintf(`{"path":%q}`, dir)); err != nil {
+		t.Fatal("init file session err", err)
+	}
+	sess, _ := pder.SessionRead("oldsid")
+	sess.Set("tag", "hello")
+	sess.SessionRelease(nil)
+	if !pder.SessionExist("oldsid") || pder.SessionAll() != 1 {
+		t.Fatal("file session was not written")
+	}
+	reread, _ := pder.SessionRead("oldsid")
+	if reread.Get("tag") != "hello" {
+		t.Fatal("file session data was not read back")
+	}
+	regen, _ := pder.SessionRegenerate("oldsid", "newsid")
+	if regen.Get("tag") != "hello" || pder.SessionExist("oldsid") {
+		t.Fatal("file session regenerate error")
+	}
+	if pder.SessionExist("../newsid") {
+		t.Fatal("file session accepted a sid outside its path")
+	}
+	pder.SessionDestroy("newsid")
+	if pder.SessionExist("newsid") {
+		t.Fatal("file session destroy error")
+	}
+	other, _ := pder.SessionRead("othersid")
+	other.Set("tag", "hello")
+	other.SessionRelease(nil)
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "othersid"), past, past)
+	if pder.SessionExist("othersid") {
+		t.Fatal("file session exists after expiry")
+	}
+	if expired, _ := pder.SessionRead("othersid"); expired.Get("tag") != nil {
+		t.Fatal("file session read revived an expired session")
+	}
+	other.SessionRelease(nil)
+	os.Chtimes(filepath.Join(dir, "othersid"), past, past)
+	if regen, _ := pder.SessionRegenerate("othersid", "regensid"); regen.Get("tag") != nil {
+		t.Fatal("file session regenerate revived an expired session")
+	}
+	pder.maxlifetime = -1
+	pder.SessionGC()
+	if pder.SessionAll() != 0 {
+		t.Fatal("file session gc did not remove expired sessions")
+	}
+}
+
+// testSqlDriver is an in-process database/sql driver understanding only the
+// statements of the sqlite3 dialect, used to test SqlProvider.
+type testSqlRow struct {
+	data   []byte
+	expiry int64
+}
+
+type testSqlDriver struct {
+	lock  sync.Mutex
+	table map[string]*testSqlRow
+}
+
+type testSqlConn struct{ d *testSqlDriver }
+
+type testSqlStmt struct {
+	d     *testSqlDriver
+	query string
+}
+
+type testSqlRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (d *testSqlDriver) Open(name string) (driver.Conn, error) { return &testSqlConn{d}, nil }
+
+func (c *testSqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &testSqlStmt{c.d, query}, nil
+}
+func (c *testSqlConn) Close() error              { return nil }
+func (c *testSqlConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *testSqlConn) Commit() error             { return nil }
+func (c *testSqlConn) Rollback() error           { return nil }
+
+func (s *testSqlStmt) Close() error  { return nil }
+func (s *testSqlStmt) NumInput() int { return -1 }
+
+func (s *testSqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.lock.Lock()
+	defer s.d.lock.Unlock()
+	var affected int64
+	dl := dialects["sqlite3"]
+	switch s.query {
+	case dl.Schema:
+	case dl.Insert:
+		if _, ok := s.d.table[args[0].(string)]; !ok {
+			s.d.table[args[0].(string)] = &testSqlRow{args[1].([]byte), args[2].(int64)}
+			affected = 1
+		} else if !strings.Contains(s.query, "OR IGNORE") {
+			return nil, fmt.Errorf("UNIQUE constraint failed: flotilla_session.session_key")
+		}
+	case dl.Update:
+		if row, ok := s.d.table[args[2].(string)]; ok {
+			row.data, row.expiry = args[0].([]byte), args[1].(int64)
+			affected = 1
+		}
+	case dl.Touch:
+		if row, ok := s.d.table[args[1].(string)]; ok {
+			row.expiry = args[0].(int64)
+			affected = 1
+		}
+	case dl.Regenerate:
+		if row, ok := s.d.table[args[2].(string)]; ok && row.expiry >= args[3].(int64) {
+			delete(s.d.table, args[2].(string))
+			row.expiry = args[1].(int64)
+			s.d.table[args[0].(string)] = row
+			affected = 1
+		}
+	case dl.Destroy:
+		if _, ok := s.d.table[args[0].(string)]; ok {
+			delete(s.d.table, args[0].(string))
+			affected = 1
+		}
+	case dl.Expire:
+		if row, ok := s.d.table[args[0].(string)]; ok && row.expiry < args[1].(int64) {
+			delete(s.d.table, args[0].(string))
+			affected = 1
+		}
+	case dl.GC:
+		for k, row := range s.d.table {
+			if row.expiry < args[0].(int64) {
+				delete(s.d.table, k)
+				affected++
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported exec: %s", s.query)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *testSqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.lock.Lock()
+	defer s.d.lock.Unlock()
+	dl := dialects["sqlite3"]
+	switch s.query {
+	case dl.Read:
+		if row, ok := s.d.table[args[0].(string)]; ok && row.expiry >= args[1].(int64) {
+			return &testSqlRows{values: []driver.Value{row.data}}, nil
+		}
+		return &testSqlRows{done: true}, nil
+	case dl.Exist:
+		if row, ok := s.d.table[args[0].(string)]; ok && row.expiry >= args[1].(int64) {
+			return &testSqlRows{values: []driver.Value{int64(1)}}, nil
+		}
+		return &testSqlRows{values: []driver.Value{int64(0)}}, nil
+	case dl.Count:
+		var count int64
+		for _, row := range s.d.table {
+			if row.expiry >= args[0].(int64) {
+				count++
+			}
+		}
+		return &testSqlRows{values: []driver.Value{count}}, nil
+	}
+	return nil, fmt.Errorf("unsupported query: %s", s.query)
+}
+
+func (r *testSqlRows) Columns() []string { return make([]string, len(r.values)) }
+func (r *testSqlRows) Close() error      { return nil }
+
+func (r *testSqlRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.done = true
+	return nil
+}
+
+func init() {
+	sql.Register("flotillatest", &testSqlDriver{table: make(map[string]*testSqlRow)})
+}
+
+func TestSqlProvider(t *testing.T) {
+	config := `{"cookieName":"gosessionid","gclifetime":3600,"ProviderConfig":"{\"driver\":\"flotillatest\",\"dialect\":\"sqlite3\",\"createSchema\":true}"}`
+	globalSessions, err := NewManager("sql", config)
+	if err != nil {
+		t.Fatal("init sql session err", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess := globalSessions.SessionStart(w, r)
+	sess.Set("username", "Walter Skinner")
+	sess.SessionRelease(w)
+	cookie, _ := r.Cookie("gosessionid")
+	r2, _ := http.NewRequest("GET", "/", nil)
+	r2.AddCookie(cookie)
+	sess2 := globalSessions.SessionStart(httptest.NewRecorder(), r2)
+	if sess2.Get("username") != "Walter Skinner" {
+		t.Fatal("sql session data was not saved")
+	}
+
+	pder := globalSessions.provider.(*SqlProvider)
+	regen, err := pder.SessionRegenerate(sess.SessionID(), "newsid")
+	if err != nil || regen.Get("username") != "Walter Skinner" {
+		t.Fatal("sql session regenerate error", err)
+	}
+	if pder.SessionExist(sess.SessionID()) || !pder.SessionExist("newsid") {
+		t.Fatal("sql session regenerate did not move the session")
+	}
+	pder.SessionRead("othersid")
+	if pder.SessionAll() != 2 {
+		t.Fatal("sql session count error")
+	}
+	pder.SessionDestroy("othersid")
+	if pder.SessionExist("othersid") {
+		t.Fatal("sql session destroy error")
+	}
+	lifetime := pder.maxlifetime
+	expire := func(sid string) {
+		pder.maxlifetime = -10
+		defer func() { pder.maxlifetime = lifetime }()
+		st, _ := pder.SessionRead(sid)
+		st.Set("username", "Alex Krycek")
+		st.SessionRelease(httptest.NewRecorder())
+	}
+	expire("expiredsid")
+	if pder.SessionExist("expiredsid") || pder.SessionAll() != 1 {
+		t.Fatal("sql session exists past its expiry")
+	}
+	if st, err := pder.SessionRead("expiredsid"); err != nil || st.Get("username") != nil {
+		t.Fatal("sql session was read past its expiry", err)
+	}
+	expire("expiredsid")
+	if regen, err := pder.SessionRegenerate("expiredsid", "regensid"); err != nil || regen.Get("username") != nil {
+		t.Fatal("sql session regenerate kept an expired session", err)
+	}
+	pder.SessionDestroy("expiredsid")
+	pder.SessionDestroy("regensid")
+	pder.maxlifetime = -10
+	pder.SessionUpdate("newsid")
+	pder.SessionGC()
+	if pder.SessionAll() != 0 {
+		t.Fatal("sql session gc did not remove expired sessions")
+	}
+}
+
+func TestSqlProviderConcurrentRead(t *testing.T) {
+	db, _ := sql.Open("flotillatest", "")
+	pder, _ := NewSqlProvider(db, "sqlite3")
+	pder.SessionInit(3600, "")
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pder.SessionRead("concurrentsid"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("concurrent first reads of a sql session conflicted:", err)
+	}
+	pder.SessionDestroy("concurrentsid")
+}
+
+func TestSessionStartReadError(t *testing.T) {
+	RegisterDialect("flotillabroken", &SqlDialect{Read: "SELECT broken"})
+	db, _ := sql.Open("flotillatest", "")
+	pder, _ := NewSqlProvider(db, "flotillabroken")
+	m, err := NewManager(pder, `{"cookieName":"gosessionid","gclifetime":3600}`)
+	if err != nil {
+		t.Fatal("init sql session err", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess := m.SessionStart(httptest.NewRecorder(), r)
+	if sess == nil || sess.Get("username") != nil || sess.Set("username", "Alex Krycek") == nil {
+		t.Fatal("an unread session was not reported by its SessionStore")
+	}
+}
+
+func TestCookieProviderInstances(t *testing.T) {
+	one, err := NewManager("cookie", `{"cookieName":"one","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"one\",\"securityKey\":\"keyone\"}"}`)
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	pder := NewCookieProvider()
+	two, err := NewManager(pder, `{"cookieName":"two","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"two\",\"securityKey\":\"keytwo\"}"}`)
+	if err != nil {
+		t.Fatal("init cookie session from instance err", err)
+	}
+	if one.provider == two.provider || two.provider != pder {
+		t.Fatal("cookie managers share a provider")
+	}
+	for name, m := range map[string]*Manager{"one": one, "two": two} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		sess := m.SessionStart(w, r)
+		sess.SessionRelease(w)
+		if !strings.HasPrefix(w.Header().Get("Set-Cookie"), name+"=") {
+			t.Fatalf("cookie manager %s released with another configuration", name)
+		}
+	}
+	if _, err := NewManager(42, "{}"); err == nil {
+		t.Fatal("NewManager accepted an invalid provide")
+	}
+}
+
+func TestCookieEncodeDecodeAEAD(t *testing.T) {
+	old, _ := newKeyRing("oldsecret")
+	val := make(map[interface{}]interface{})
+	val["tag"] = "hello"
+	str, err := encodeCookieAEAD(GobSerializer{}, old, "gosessionid", val)
+	if err != nil {
+		t.Fatal("encodeCookieAEAD:", err)
+	}
+	rotated, _ := newKeyRing("newsecret", "oldsecret")
+	dst, err := decodeCookieAEAD(GobSerializer{}, rotated, "gosessionid", str, 3600)
+	if err != nil {
+		t.Fatal("decodeCookieAEAD with rotated ring:", err)
+	}
+	if dst["tag"] != "hello" {
+		t.Fatal("dst get map error")
+	}
+	if _, err := decodeCookieAEAD(GobSerializer{}, rotated, "othername", str, 3600); err == nil {
+		t.Fatal("decodeCookieAEAD accepted a value sealed for another name")
+	}
+	dropped, _ := newKeyRing("newsecret")
+	if _, err := decodeCookieAEAD(GobSerializer{}, dropped, "gosessionid", str, 3600); err == nil {
+		t.Fatal("decodeCookieAEAD accepted a value from a key not in the ring")
+	}
+	if _, err := newKeyRing(""); err == nil {
+		t.Fatal("newKeyRing accepted an empty ring")
+	}
+}
+
+func TestKeyRingDerivation(t *testing.T) {
+	// RFC 5869 test case 3, the first 32 bytes of OKM
+	if key := hex.EncodeToString(hkdfSHA256(strings.Repeat("\x0b", 22), "")); key != "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d" {
+		t.Fatalf("hkdf derived %s", key)
+	}
+	raw := sha256.Sum256([]byte("secret"))
+	if bytes.Equal(hkdfSHA256("secret", keyRingInfo), raw[:]) {
+		t.Fatal("the encryption key is the hash of the secret")
+	}
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	config := func(keys string) string {
+		return fmt.Sprintf(`{"cookieName":"gosessionid","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"gosessionid\",\"keys\":[%s]}"}`, keys)
+	}
+	before, err := NewManager("cookie", config(`\"first\"`))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess := before.SessionStart(w, r)
+	sess.Set("username", "Assistant Director Skinner")
+	sess.SessionRelease(w)
+	cookie := w.Result().Cookies()[0]
+
+	after, err := NewManager("cookie", config(`\"second\",\"first\"`))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	r2, _ := http.NewRequest("GET", "/", nil)
+	r2.AddCookie(cookie)
+	if after.SessionStart(httptest.NewRecorder(), r2).Get("username") != "Assistant Director Skinner" {
+		t.Fatal("cookie session was not readable after key rotation")
+	}
+}
+
+func TestCookieLegacyFallback(t *testing.T) {
+	config := func(cfg string) string {
+		return fmt.Sprintf(`{"cookieName":"gosessionid","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"gosessionid\",\"securityKey\":\"sk\",\"blockKey\":\"0123456789abcdef\",\"securityName\":\"sn\"%s}"}`, cfg)
+	}
+	ctr, err := NewManager("cookie", config(`,\"cipher\":\"ctr\"`))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess := ctr.SessionStart(w, r)
+	sess.Set("tag", "legacy")
+	sess.SessionRelease(w)
+	legacy := w.Result().Cookies()[0]
+
+	read := func(m *Manager, cookie *http.Cookie) (SessionStore, *httptest.ResponseRecorder) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		return m.SessionStart(w, r), w
+	}
+	gcm, _ := NewManager("cookie", config(`,\"keys\":[\"secret\"]`))
+	if sess, _ := read(gcm, legacy); sess.Get("tag") != nil {
+		t.Fatal("a legacy cookie was decoded without legacy configured")
+	}
+	migrating, _ := NewManager("cookie", config(`,\"keys\":[\"secret\"],\"legacy\":true`))
+	sess, w = read(migrating, legacy)
+	if sess.Get("tag") != "legacy" {
+		t.Fatal("a legacy cookie was not decoded with legacy configured")
+	}
+	sess.SessionRelease(w)
+	if sess, _ := read(gcm, w.Result().Cookies()[0]); sess.Get("tag") != "legacy" {
+		t.Fatal("a legacy cookie was not re-issued as a gcm cookie")
+	}
+}
+
+func TestSessionRegenerate(t *testing.T) {
+	for _, provider := range []string{"memory", "cookie"} {
+		config := `{"cookieName":"gosessionid","gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"gosessionid\",\"keys\":[\"secret\"]}"}`
+		m, err := NewManager(provider, config)
+		if err != nil {
+			t.Fatal("init session err", err)
+		}
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		sess := m.SessionStart(w, r)
+		sess.Set("username", "Alex Krycek")
+		oldsid := sess.SessionID()
+		regen := m.SessionRegenerate(w, r, sess)
+		if regen.SessionID() == oldsid {
+			t.Fatalf("%s session id was not regenerated", provider)
+		}
+		if regen.Get("username") != "Alex Krycek" {
+			t.Fatalf("%s session data was not kept", provider)
+		}
+		if cookie, _ := r.Cookie("gosessionid"); cookie.Value != regen.SessionID() {
+			t.Fatalf("%s request cookie was not replaced", provider)
+		}
+		if provider == "memory" && m.provider.SessionExist(oldsid) {
+			t.Fatalf("%s old session id is still valid", provider)
+		}
+		regen.SessionRelease(w)
+		var set []*http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "gosessionid" {
+				set = append(set, c)
+			}
+		}
+		if len(set) != 1 {
+			t.Fatalf("%s response set the session cookie %d times", provider, len(set))
+		}
+		if provider == "memory" && set[0].Value != regen.SessionID() {
+			t.Fatalf("%s response set the session cookie to %q, not the regenerated id", provider, set[0].Value)
+		}
+	}
+
+	m, _ := NewManager("memory", `{"cookieName":"gosessionid","gclifetime":3600}`)
+	r, _ := http.NewRequest("GET", "/", nil)
+	if sess := m.SessionRegenerateId(httptest.NewRecorder(), r); sess == nil {
+		t.Fatal("regenerate without a session cookie returned no session")
+	}
+}
+
+func TestJSONSerializer(t *testing.T) {
+	s := NewJSONSerializer()
+	s.Register("session.User", User{})
+	val := make(map[interface{}]interface{})
+	val["count"] = 3
+	val["user"] = User{"dscully", "Scully"}
+	b, err := s.Encode(val)
+	if err != nil {
+		t.Fatal("json encode:", err)
+	}
+	dst, err := s.Decode(b)
+	if err != nil {
+		t.Fatal("json decode:", err)
+	}
+	if dst["count"] != 3 || dst["user"] != (User{"dscully", "Scully"}) {
+		t.Fatalf("json serializer did not keep value types: %#v", dst)
+	}
+	if _, err := NewJSONSerializer().Decode(b); err == nil || !strings.Contains(err.Error(), `unknown type "session.User"`) {
+		t.Fatalf("json decode of an unregistered type did not fail clearly: %v", err)
+	}
+	if _, err := s.Encode(map[interface{}]interface{}{1: "one"}); err == nil {
+		t.Fatal("json encode accepted a key that is not a string")
+	}
+
+	config := `{"cookieName":"gosessionid","enableSetCookie":false,"gclifetime":3600,"ProviderConfig":"{\"cookieName\":\"gosessionid\",\"keys\":[\"secret\"],\"serializer\":\"json\"}"}`
+	m, err := NewManager("cookie", config)
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	if _, ok := m.provider.(*CookieProvider).serializer.(*JSONSerializer); !ok {
+		t.Fatal("cookie provider did not use the configured serializer")
+	}
+	if _, err := NewManager("cookie", strings.Replace(config, "json", "unknown", 1)); err == nil {
+		t.Fatal("cookie provider accepted an unknown serializer")
+	}
+}
@@ -0,0 +1,361 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	sqlpder = &SqlProvider{}
+
+	dialects = map[string]*SqlDialect{
+		"mysql": &SqlDialect{
+			Schema: "CREATE TABLE IF NOT EXISTS flotilla_session (" +
+				"session_key CHAR(64) NOT NULL PRIMARY KEY, " +
+				"session_data BLOB, " +
+				"session_expiry BIGINT NOT NULL, " +
+				"INDEX session_expiry_idx (session_expiry)" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			Read:       "SELECT session_data FROM flotilla_session WHERE session_key = ? AND session_expiry >= ?",
+			Exist:      "SELECT COUNT(*) FROM flotilla_session WHERE session_key = ? AND session_expiry >= ?",
+			Insert:     "INSERT IGNORE INTO flotilla_session (session_key, session_data, session_expiry) VALUES (?, ?, ?)",
+			Update:     "UPDATE flotilla_session SET session_data = ?, session_expiry = ? WHERE session_key = ?",
+			Touch:      "UPDATE flotilla_session SET session_expiry = ? WHERE session_key = ?",
+			Regenerate: "UPDATE flotilla_session SET session_key = ?, session_expiry = ? WHERE session_key = ? AND session_expiry >= ?",
+			Destroy:    "DELETE FROM flotilla_session WHERE session_key = ?",
+			Expire:     "DELETE FROM flotilla_session WHERE session_key = ? AND session_expiry < ?",
+			GC:         "DELETE FROM flotilla_session WHERE session_expiry < ?",
+			Count:      "SELECT COUNT(*) FROM flotilla_session WHERE session_expiry >= ?",
+		},
+		"postgres": &SqlDialect{
+			Schema: "CREATE TABLE IF NOT EXISTS flotilla_session (" +
+				"session_key CHAR(64) NOT NULL PRIMARY KEY, " +
+				"session_data BYTEA, " +
+				"session_expiry BIGINT NOT NULL" +
+				"); CREATE INDEX IF NOT EXISTS session_expiry_idx ON flotilla_session (session_expiry)",
+			Read:       "SELECT session_data FROM flotilla_session WHERE session_key = $1 AND session_expiry >= $2",
+			Exist:      "SELECT COUNT(*) FROM flotilla_session WHERE session_key = $1 AND session_expiry >= $2",
+			Insert:     "INSERT INTO flotilla_session (session_key, session_data, session_expiry) VALUES ($1, $2, $3) ON CONFLICT (session_key) DO NOTHING",
+			Update:     "UPDATE flotilla_session SET session_data = $1, session_expiry = $2 WHERE session_key = $3",
+			Touch:      "UPDATE flotilla_session SET session_expiry = $1 WHERE session_key = $2",
+			Regenerate: "UPDATE flotilla_session SET session_key = $1, session_expiry = $2 WHERE session_key = $3 AND session_expiry >= $4",
+			Destroy:    "DELETE FROM flotilla_session WHERE session_key = $1",
+			Expire:     "DELETE FROM flotilla_session WHERE session_key = $1 AND session_expiry < $2",
+			GC:         "DELETE FROM flotilla_session WHERE session_expiry < $1",
+			Count:      "SELECT COUNT(*) FROM flotilla_session WHERE session_expiry >= $1",
+		},
+		"sqlite3": &SqlDialect{
+			Schema: "CREATE TABLE IF NOT EXISTS flotilla_session (" +
+				"session_key TEXT NOT NULL PRIMARY KEY, " +
+				"session_data BLOB, " +
+				"session_expiry INTEGER NOT NULL" +
+				"); CREATE INDEX IF NOT EXISTS session_expiry_idx ON flotilla_session (session_expiry)",
+			Read:       "SELECT session_data FROM flotilla_session WHERE session_key = ? AND session_expiry >= ?",
+			Exist:      "SELECT COUNT(*) FROM flotilla_session WHERE session_key = ? AND session_expiry >= ?",
+			Insert:     "INSERT OR IGNORE INTO flotilla_session (session_key, session_data, session_expiry) VALUES (?, ?, ?)",
+			Update:     "UPDATE flotilla_session SET session_data = ?, session_expiry = ? WHERE session_key = ?",
+			Touch:      "UPDATE flotilla_session SET session_expiry = ? WHERE session_key = ?",
+			Regenerate: "UPDATE flotilla_session SET session_key = ?, session_expiry = ? WHERE session_key = ? AND session_expiry >= ?",
+			Destroy:    "DELETE FROM flotilla_session WHERE session_key = ?",
+			Expire:     "DELETE FROM flotilla_session WHERE session_key = ? AND session_expiry < ?",
+			GC:         "DELETE FROM flotilla_session WHERE session_expiry < ?",
+			Count:      "SELECT COUNT(*) FROM flotilla_session WHERE session_expiry >= ?",
+		},
+	}
+)
+
+type (
+	// SqlSessionStore is a SessionStore saved as a row of a database/sql
+	// database by a SqlProvider.
+	SqlSessionStore struct {
+		sid    string
+		values map[interface{}]interface{} // session data
+		lock   sync.RWMutex
+		pder   *SqlProvider
+	}
+
+	// SqlProvider stores sessions in any *sql.DB, using the statements of a
+	// SqlDialect. Rows hold the session key, session data encoded by the
+	// provider Serializer, and a unix expiry time. A row past its expiry is
+	// treated as missing, and deleted by gc.
+	SqlProvider struct {
+		db          *sql.DB
+		dialect     *SqlDialect
+		serializer  Serializer
+		maxlifetime int64
+	}
+
+	// SqlDialect is the schema & statements a SqlProvider uses with a specific
+	// database. Statement parameters are in the order shown for the builtin
+	// dialects. Insert must not fail for an existing session_key, e.g. INSERT
+	// OR IGNORE, so concurrent first reads of a session do not conflict.
+	SqlDialect struct {
+		Schema     string
+		Read       string // session_key, now
+		Exist      string // session_key, now
+		Insert     string // session_key, session_data, session_expiry
+		Update     string // session_data, session_expiry, session_key
+		Touch      string // session_expiry, session_key
+		Regenerate string // new session_key, session_expiry, old session_key, now
+		Destroy    string // session_key
+		Expire     string // session_key, now
+		GC         string // session_expiry
+		Count      string // now
+	}
+
+	sqlConfig struct {
+		Driver     string `json:"driver"`
+		DSN        string `json:"dsn"`
+		Dialect    string `json:"dialect"`
+		Create     bool   `json:"createSchema"`
+		Serializer string `json:"serializer"`
+	}
+)
+
+// RegisterDialect makes a SqlDialect available by the provided name, replacing
+// any existing dialect of the same name.
+func RegisterDialect(name string, dialect *SqlDialect) {
+	if dialect == nil {
+		panic("session: RegisterDialect dialect is nil")
+	}
+	dialects[name] = dialect
+}
+
+// Set value in sql session.
+func (st *SqlSessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	return nil
+}
+
+// Get value from sql session.
+func (st *SqlSessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in sql session.
+func (st *SqlSessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	return nil
+}
+
+// Clean all values in sql session.
+func (st *SqlSessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+func (st *SqlSessionStore) sessionValues() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Return id of this sql session.
+func (st *SqlSessionStore) SessionID() string {
+	return st.sid
+}
+
+// Save sql session data to the database.
+func (st *SqlSessionStore) SessionRelease(w http.ResponseWriter) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	b, err := st.pder.serializer.Encode(st.values)
+	if err != nil {
+		return
+	}
+	st.pder.db.Exec(st.pder.dialect.Update, b, st.pder.expiry(), st.sid)
+}
+
+// NewSqlProvider returns a SqlProvider using an existing database and a
+// registered dialect name (e.g. "mysql", "postgres", "sqlite3").
+func NewSqlProvider(db *sql.DB, dialect string) (*SqlProvider, error) {
+	d, ok := dialects[dialect]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown sql dialect: %q", dialect)
+	}
+	return &SqlProvider{db: db, dialect: d, serializer: GobSerializer{}}, nil
+}
+
+func (pder *SqlProvider) instance() Provider {
+	return &SqlProvider{}
+}
+
+// Init sql session provider with max lifetime and config json. A provider
+// made by NewSqlProvider may use an empty config, keeping its database.
+// json config:
+// 	driver - database/sql driver name, the driver must be imported
+// 	dsn - driver specific data source name
+// 	dialect - registered dialect name, defaults to the driver name
+// 	createSchema - execute the dialect Schema on init
+// 	serializer - registered Serializer name, "gob"(default) or "json".
+func (pder *SqlProvider) SessionInit(maxlifetime int64, config string) error {
+	cf := &sqlConfig{}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), cf); err != nil {
+			return err
+		}
+	}
+	if cf.Driver != "" {
+		db, err := sql.Open(cf.Driver, cf.DSN)
+		if err != nil {
+			return err
+		}
+		pder.db = db
+		if cf.Dialect == "" {
+			cf.Dialect = cf.Driver
+		}
+	}
+	if cf.Dialect != "" {
+		d, ok := dialects[cf.Dialect]
+		if !ok {
+			return fmt.Errorf("session: unknown sql dialect: %q", cf.Dialect)
+		}
+		pder.dialect = d
+	}
+	if cf.Serializer != "" || pder.serializer == nil {
+		s, err := getSerializer(cf.Serializer)
+		if err != nil {
+			return err
+		}
+		pder.serializer = s
+	}
+	if pder.db == nil || pder.dialect == nil {
+		return errors.New("session: sql provider requires a database and a dialect")
+	}
+	pder.maxlifetime = maxlifetime
+	if cf.Create {
+		return pder.CreateSchema()
+	}
+	return nil
+}
+
+// CreateSchema executes the dialect Schema against the provider database.
+func (pder *SqlProvider) CreateSchema() error {
+	_, err := pder.db.Exec(pder.dialect.Schema)
+	return err
+}
+
+func (pder *SqlProvider) expiry() int64 {
+	return time.Now().Unix() + pder.maxlifetime
+}
+
+type sqlQueryer interface {
+	QueryRow(string, ...interface{}) *sql.Row
+	Exec(string, ...interface{}) (sql.Result, error)
+}
+
+// read returns the session for sid through q, inserting an empty session if
+// sid does not exist or has expired. Only an expired row is deleted, and the
+// insert leaves a row inserted meanwhile, so concurrent reads of a new sid
+// do not conflict.
+func (pder *SqlProvider) read(q sqlQueryer, sid string) (*SqlSessionStore, error) {
+	var data []byte
+	now := time.Now().Unix()
+	err := q.QueryRow(pder.dialect.Read, sid, now).Scan(&data)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err = q.Exec(pder.dialect.Expire, sid, now); err != nil {
+			return nil, err
+		}
+		if _, err = q.Exec(pder.dialect.Insert, sid, []byte{}, pder.expiry()); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		q.Exec(pder.dialect.Touch, pder.expiry(), sid)
+	}
+	values := make(map[interface{}]interface{})
+	if len(data) > 0 {
+		if values, err = pder.serializer.Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return &SqlSessionStore{sid: sid, values: values, pder: pder}, nil
+}
+
+// Get SessionStore from the database by sid.
+func (pder *SqlProvider) SessionRead(sid string) (SessionStore, error) {
+	return pder.read(pder.db, sid)
+}
+
+// Check sql session exists by sid, and has not expired.
+func (pder *SqlProvider) SessionExist(sid string) bool {
+	var count int
+	if err := pder.db.QueryRow(pder.dialect.Exist, sid, time.Now().Unix()).Scan(&count); err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Move the session row for oldsid to sid within a transaction, returning the
+// SessionStore for sid, which is empty where oldsid has expired.
+func (pder *SqlProvider) SessionRegenerate(oldsid, sid string) (SessionStore, error) {
+	tx, err := pder.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(pder.dialect.Regenerate, sid, pder.expiry(), oldsid, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	st, err := pder.read(tx, sid)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Delete sql session by sid.
+func (pder *SqlProvider) SessionDestroy(sid string) error {
+	_, err := pder.db.Exec(pder.dialect.Destroy, sid)
+	return err
+}
+
+// Delete all sql sessions past their expiry.
+func (pder *SqlProvider) SessionGC() {
+	pder.db.Exec(pder.dialect.GC, time.Now().Unix())
+}
+
+// Return the count of sql sessions that have not expired.
+func (pder *SqlProvider) SessionAll() int {
+	var count int
+	if err := pder.db.QueryRow(pder.dialect.Count, time.Now().Unix()).Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+// Update the expiry of a sql session by sid.
+func (pder *SqlProvider) SessionUpdate(sid string) error {
+	_, err := pder.db.Exec(pder.dialect.Touch, pder.expiry(), sid)
+	return err
+}
+
+func init() {
+	Register("sql", sqlpder)
+}
@@ -2,10 +2,12 @@ package session
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	cr "crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/gob"
@@ -107,11 +109,11 @@ func decode(value []byte) ([]byte, error) {
 	return decoded[:b], nil
 }
 
-func encodeCookie(block cipher.Block, hashKey, name string, value map[interface{}]interface{}) (string, error) {
+func encodeCookie(s Serializer, block cipher.Block, hashKey, name string, value map[interface{}]interface{}) (string, error) {
 	var err error
 	var b []byte
-	// 1. EncodeGob.
-	if b, err = EncodeGob(value); err != nil {
+	// 1. Serialize.
+	if b, err = s.Encode(value); err != nil {
 		return "", err
 	}
 	// 2. Encrypt (optional).
@@ -132,7 +134,7 @@ func encodeCookie(block cipher.Block, hashKey, name string, value map[interface{
 	return string(b), nil
 }
 
-func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+func decodeCookie(s Serializer, block cipher.Block, hashKey, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
 	// 1. Decode from base64.
 	b, err := decode([]byte(value))
 	if err != nil {
@@ -171,14 +173,110 @@ func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime
 	if b, err = decrypt(block, b); err != nil {
 		return nil, err
 	}
-	// 5. DecodeGob.
-	if dst, err := DecodeGob(b); err != nil {
+	// 5. Deserialize.
+	if dst, err := s.Decode(b); err != nil {
 		return nil, err
 	} else {
 		return dst, nil
 	}
 }
 
+// keyRing holds AES-GCM ciphers derived from a list of secrets. The first is
+// the primary key used to encode, all keys are tried when decoding so that
+// older secrets remain readable after rotation.
+type keyRing []cipher.AEAD
+
+// keyRingInfo is the HKDF info of keys derived by newKeyRing, keeping them
+// apart from any other use of the secrets, e.g. signing cookies.
+const keyRingInfo = "session-encryption"
+
+// hkdfSHA256 derives a 256 bit key from secret for the purpose named by info,
+// with HKDF-SHA256(RFC 5869) and no salt.
+func hkdfSHA256(secret, info string) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write([]byte(secret))
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// newKeyRing derives a 256 bit AES key from each non-empty secret, with HKDF
+// for session encryption.
+func newKeyRing(secrets ...string) (keyRing, error) {
+	var ring keyRing
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		block, err := aes.NewCipher(hkdfSHA256(secret, keyRingInfo))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ring = append(ring, aead)
+	}
+	if len(ring) == 0 {
+		return nil, errors.New("keyring: at least one key is required")
+	}
+	return ring, nil
+}
+
+// encodeCookieAEAD seals "date|value" with the primary key of the ring, using
+// name as additional data, and encodes nonce + ciphertext to base64.
+func encodeCookieAEAD(s Serializer, ring keyRing, name string, value map[interface{}]interface{}) (string, error) {
+	b, err := s.Encode(value)
+	if err != nil {
+		return "", err
+	}
+	b = append([]byte(fmt.Sprintf("%d|", time.Now().UTC().Unix())), b...)
+	aead := ring[0]
+	nonce := generateRandomKey(aead.NonceSize())
+	b = aead.Seal(nonce, nonce, b, []byte(name))
+	return string(encode(b)), nil
+}
+
+// decodeCookieAEAD opens a value produced by encodeCookieAEAD with any key of
+// the ring, then verifies the date range.
+func decodeCookieAEAD(s Serializer, ring keyRing, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+	b, err := decode([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+	var opened []byte
+	for _, aead := range ring {
+		size := aead.NonceSize()
+		if len(b) < size {
+			continue
+		}
+		if opened, err = aead.Open(nil, b[:size], b[size:], []byte(name)); err == nil {
+			break
+		}
+	}
+	if opened == nil {
+		return nil, errors.New("Decode: the value is not valid")
+	}
+	parts := bytes.SplitN(opened, []byte("|"), 2)
+	if len(parts) != 2 {
+		return nil, errors.New("Decode: invalid value")
+	}
+	var t1 int64
+	if t1, err = strconv.ParseInt(string(parts[0]), 10, 64); err != nil {
+		return nil, errors.New("Decode: invalid timestamp")
+	}
+	t2 := time.Now().UTC().Unix()
+	if t1 > t2 {
+		return nil, errors.New("Decode: timestamp is too new")
+	}
+	if t1 < t2-gcmaxlifetime {
+		return nil, errors.New("Decode: expired timestamp")
+	}
+	return s.Decode(parts[1])
+}
+
 // Encryption -----------------------------------------------------------------
 
 // encrypt encrypts a value using the given block in counter mode.
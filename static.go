@@ -1,8 +1,18 @@
 package flotilla
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type (
@@ -11,11 +21,29 @@ type (
 		Exists(string, *Ctx) bool
 	}
 
+	// The default Staticor, resolving requested paths against an index of the
+	// files in its static directories. In development mode the index is rebuilt
+	// on changes to the directories, watched from the first file looked for
+	// until closed, e.g. by App.Close, otherwise it is built once and cached.
 	staticor struct {
-		staticDirs []string
+		lock         sync.RWMutex
+		env          *Env
+		staticDirs   []string
+		index        map[string]string
+		fingerprints map[string]string
+		watcher      *watcher
+	}
+
+	// fingerprinter is implemented by a Staticor providing the content hash
+	// fingerprint of a requested file, for use in cache busting static urls.
+	fingerprinter interface {
+		Fingerprint(string) (string, bool)
 	}
 )
 
+// The Cache-Control header value for files requested by fingerprinted url.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
 func (env *Env) StaticorInit() {
 	if env.Staticor == nil {
 		env.Staticor = NewStaticor(env)
@@ -32,53 +60,390 @@ func (env *Env) StaticDirs(dirs ...string) []string {
 }
 
 func NewStaticor(env *Env) *staticor {
-	s := &staticor{}
+	s := &staticor{env: env}
 	s.StaticDirs(env.Store["STATIC_DIRECTORIES"].List()...)
+	if env.Mode.Development && !env.Mode.Production {
+		s.watcher = newWatcher(time.Second, s.dirs, s.refresh)
+	}
 	return s
 }
 
+// Close stops any watcher rebuilding the index in development mode, started on
+// the first file looked for.
+func (s *staticor) Close() error {
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+	return nil
+}
+
+func (s *staticor) dirs() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]string(nil), s.staticDirs...)
+}
+
 func (s *staticor) StaticDirs(dirs ...string) []string {
+	s.lock.Lock()
+	added := false
 	for _, dir := range dirs {
-		s.staticDirs = doAdd(dir, s.staticDirs)
+		if isAppendable(dir, s.staticDirs) {
+			s.staticDirs = append(s.staticDirs, dir)
+			added = true
+		}
 	}
-	return s.staticDirs
+	ret := s.staticDirs
+	s.lock.Unlock()
+	if added || s.index == nil {
+		s.refresh()
+	}
+	return ret
 }
 
-func appStaticFile(requested string, ctx *Ctx) bool {
-	exists := false
-	for _, dir := range ctx.App.StaticDirs() {
-		filepath.Walk(dir, func(path string, _ os.FileInfo, _ error) (err error) {
-			if filepath.Base(path) == requested {
-				f, _ := os.Open(path)
-				ctx.ServeFile(f)
-				exists = true
+// refresh rebuilds the index of slash separated paths, relative to their static
+// directory, to files. Where a path exists in more than one directory, the
+// first directory listed takes precedence.
+func (s *staticor) refresh() {
+	index := make(map[string]string)
+	for _, dir := range s.dirs() {
+		filepath.Walk(dir, func(fp string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			if rel, err := filepath.Rel(dir, fp); err == nil {
+				rel = filepath.ToSlash(rel)
+				if _, exists := index[rel]; !exists {
+					index[rel] = fp
+				}
 			}
-			return err
+			return nil
 		})
 	}
-	return exists
+	s.lock.Lock()
+	s.index = index
+	s.fingerprints = make(map[string]string)
+	s.lock.Unlock()
 }
 
-func appAssetFile(requested string, ctx *Ctx) bool {
-	exists := false
-	f, err := ctx.App.Assets.Get(requested)
-	if err == nil {
-		ctx.ServeFile(f)
-		exists = true
+func (s *staticor) staticFile(requested string) (http.File, bool) {
+	s.lock.RLock()
+	fp, exists := s.index[requested]
+	s.lock.RUnlock()
+	if exists {
+		f, err := os.Open(fp)
+		if err == nil {
+			return f, true
+		}
 	}
-	return exists
+	return nil, false
 }
 
+// assetFile returns the requested file from the App assets, by its exact path
+// under a directory of the assets named as a static directory, e.g.
+// "static/css/app.css" for "css/app.css" with the static directory "static",
+// or else by the requested path itself. Files under a directory of the assets
+// named as a template directory are never served.
+func (s *staticor) assetFile(requested string) (http.File, bool) {
+	requested = strings.TrimPrefix(requested, "/")
+	for _, base := range dirBases(s.env.TemplateDirs()) {
+		if strings.HasPrefix(requested, base+"/") {
+			return nil, false
+		}
+	}
+	if f, err := s.env.Assets.getIn(s.dirs(), requested); err == nil {
+		return f, true
+	}
+	return nil, false
+}
+
+func (s *staticor) find(requested string) (http.File, bool) {
+	if s.watcher != nil {
+		s.watcher.Start()
+	}
+	if f, exists := s.staticFile(requested); exists {
+		return f, true
+	}
+	return s.assetFile(requested)
+}
+
+// Fingerprint returns the content hash fingerprint of the requested file, kept
+// in a manifest of requested files until the static directories change.
+func (s *staticor) Fingerprint(requested string) (string, bool) {
+	s.lock.RLock()
+	fingerprint, ok := s.fingerprints[requested]
+	s.lock.RUnlock()
+	if ok {
+		return fingerprint, true
+	}
+	f, exists := s.find(requested)
+	if !exists {
+		return "", false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", false
+	}
+	etag, err := fileETag(f, fi)
+	if err != nil {
+		return "", false
+	}
+	fingerprint = etag[1 : 1+fingerprintLen]
+	s.lock.Lock()
+	s.fingerprints[requested] = fingerprint
+	s.lock.Unlock()
+	return fingerprint, true
+}
+
+// unfingerprint returns the requested file named by a fingerprinted path, if
+// the fingerprint matches the current content of the file.
+func (s *staticor) unfingerprint(fingerprinted string) (string, bool) {
+	for _, candidate := range unfingerprinted(fingerprinted) {
+		if fingerprint, ok := s.Fingerprint(candidate.requested); ok && fingerprint == candidate.fingerprint {
+			return candidate.requested, true
+		}
+	}
+	return "", false
+}
+
+// Exists serves the requested file from the static directories or app assets,
+// in place of which a precompressed .br or .gz sibling is served to clients
+// accepting that encoding. A fingerprinted path is served as the file it names
+// with an immutable Cache-Control.
 func (s *staticor) Exists(requested string, ctx *Ctx) bool {
-	exists := appStaticFile(requested, ctx)
+	f, exists := s.find(requested)
+	immutable := false
+	if !exists {
+		if real, ok := s.unfingerprint(requested); ok {
+			f, exists = s.find(real)
+			requested, immutable = real, exists
+		}
+	}
 	if !exists {
-		exists = appAssetFile(requested, ctx)
+		return false
+	}
+	defer f.Close()
+	header := ctx.rw.Header()
+	header.Add("Vary", "Accept-Encoding")
+	for _, enc := range precompressed {
+		if !acceptsEncoding(ctx.Request, enc.encoding) {
+			continue
+		}
+		if cf, ok := s.find(requested + enc.ext); ok {
+			defer cf.Close()
+			f = cf
+			header.Set("Content-Encoding", enc.encoding)
+			break
+		}
+	}
+	if ctype := mime.TypeByExtension(path.Ext(requested)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+	if immutable {
+		header.Set("Cache-Control", immutableCacheControl)
+	} else if cc := ctx.App.Env.CacheControl(ctx.route, requested); cc != "" {
+		header.Set("Cache-Control", cc)
+	}
+	ctx.ServeFile(f)
+	return true
+}
+
+// The number of hex characters of the content hash used as a fingerprint.
+const fingerprintLen = 8
+
+// fingerprinted inserts the fingerprint into the requested path before its
+// extension, e.g. css/app.css becomes css/app.3f2a9c1d.css
+func fingerprinted(requested, fingerprint string) string {
+	ext := path.Ext(requested)
+	return strings.TrimSuffix(requested, ext) + "." + fingerprint + ext
+}
+
+type fingerprintCandidate struct {
+	requested, fingerprint string
+}
+
+// unfingerprinted returns the requested paths & fingerprints a fingerprinted
+// path may have been made from, with the fingerprint before the extension or,
+// for a file without extension, as the extension.
+func unfingerprinted(fingerprinted string) []fingerprintCandidate {
+	var candidates []fingerprintCandidate
+	ext := path.Ext(fingerprinted)
+	stem := strings.TrimSuffix(fingerprinted, ext)
+	if hash := path.Ext(stem); isFingerprint(hash) {
+		candidates = append(candidates, fingerprintCandidate{strings.TrimSuffix(stem, hash) + ext, hash[1:]})
+	}
+	if isFingerprint(ext) {
+		candidates = append(candidates, fingerprintCandidate{stem, ext[1:]})
+	}
+	return candidates
+}
+
+func isFingerprint(ext string) bool {
+	if len(ext) != fingerprintLen+1 {
+		return false
+	}
+	for _, r := range ext[1:] {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
 	}
-	return exists
+	return true
+}
+
+// staticPrefix returns the url path of the first, in path order, of the App's
+// static routes.
+func (app *App) staticPrefix() (string, bool) {
+	var prefix string
+	for _, rt := range app.Routes() {
+		if rt.static && (prefix == "" || rt.path < prefix) {
+			prefix = rt.path
+		}
+	}
+	return dropTrailing(prefix, "*filepath"), prefix != ""
+}
+
+// StaticUrl returns a fingerprinted url for the requested static file, served
+// by the App's static routes with an immutable Cache-Control, such that the
+// url changes with the content of the file.
+func (app *App) StaticUrl(requested string) (string, error) {
+	prefix, ok := app.staticPrefix()
+	if !ok {
+		return "", newError("no static route to serve %s", requested)
+	}
+	requested = strings.TrimPrefix(path.Clean("/"+requested), "/")
+	if fp, ok := app.Staticor.(fingerprinter); ok {
+		fingerprint, exists := fp.Fingerprint(requested)
+		if !exists {
+			return "", newError("static file %s unavailable", requested)
+		}
+		requested = fingerprinted(requested, fingerprint)
+	}
+	return path.Join(prefix, requested), nil
+}
+
+var precompressed = []struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the request
+// lists the encoding with a non-zero quality.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(accepted, ";")
+		if strings.TrimSpace(params[0]) != encoding {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// CacheControl returns the Cache-Control header value for a file served by a
+// static route, from the [static] section of the Env Store. The most specific
+// of these keys applies:
+// 	cachecontrol.<ext> - for files with the extension, e.g. cachecontrol.css
+// 	cachecontrol<route> - for files served by the static route, e.g. cachecontrol/static
+// 	cachecontrol - for all static files
+func (env *Env) CacheControl(route *Route, requested string) string {
+	if ext := path.Ext(requested); ext != "" {
+		if item, ok := env.Store["STATIC_CACHECONTROL"+strings.ToUpper(ext)]; ok {
+			return item.Value
+		}
+	}
+	if route != nil {
+		prefix := strings.TrimSuffix(dropTrailing(route.path, "*filepath"), "/")
+		if item, ok := env.Store["STATIC_CACHECONTROL"+strings.ToUpper(prefix)]; ok {
+			return item.Value
+		}
+	}
+	if item, ok := env.Store["STATIC_CACHECONTROL"]; ok {
+		return item.Value
+	}
+	return ""
+}
+
+var etags = struct {
+	sync.RWMutex
+	tags map[string]etagEntry
+}{tags: make(map[string]etagEntry)}
+
+type etagEntry struct {
+	size    int64
+	modtime time.Time
+	tag     string
+}
+
+// fileETag returns a strong ETag from a hash of the file content. The ETag of
+// files with a known identity, files on disk and app assets, is kept until
+// the size or modification time of the file changes.
+func fileETag(f http.File, fi os.FileInfo) (string, error) {
+	var id string
+	switch file := f.(type) {
+	case *os.File:
+		id = file.Name()
+	case *AssetFile:
+		id = "asset:" + file.Path
+	}
+	if id != "" {
+		etags.RLock()
+		e, ok := etags.tags[id]
+		etags.RUnlock()
+		if ok && e.size == fi.Size() && e.modtime.Equal(fi.ModTime()) {
+			return e.tag, nil
+		}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	tag := fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+	if id != "" {
+		etags.Lock()
+		etags.tags[id] = etagEntry{fi.Size(), fi.ModTime(), tag}
+		etags.Unlock()
+	}
+	return tag, nil
+}
+
+// staticPath returns the cleaned, slash separated path requested by the
+// *filepath splat of a static route, or false for a path attempting to
+// traverse outside of the static directories.
+func staticPath(ctx *Ctx) (string, bool) {
+	requested := ctx.Request.URL.Path
+	if ctx.route != nil {
+		requested = strings.TrimPrefix(requested, dropTrailing(ctx.route.path, "*filepath"))
+	}
+	if strings.ContainsAny(requested, "\\\x00") {
+		return "", false
+	}
+	for _, segment := range strings.Split(requested, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	requested = strings.TrimPrefix(path.Clean("/"+requested), "/")
+	return requested, requested != ""
 }
 
 func handleStatic(ctx *Ctx) {
-	requested := filepath.Base(ctx.Request.URL.Path)
+	requested, ok := staticPath(ctx)
+	if !ok {
+		ctx.Abort(404)
+		return
+	}
 	exists := ctx.App.Staticor.Exists(requested, ctx)
 	if !exists {
 		ctx.Abort(404)
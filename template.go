@@ -1,11 +1,15 @@
 package flotilla
 
 import (
-	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/thrisp/djinn"
 )
@@ -19,10 +23,26 @@ type (
 		UpdateTemplateDirs(...string)
 	}
 
-	// The default Flotilla templator
+	// TemplateCacher is implemented by a Templator caching templates, e.g. the
+	// default templator or HTMLTemplator, reporting the use of its cache.
+	TemplateCacher interface {
+		CacheStats() TemplateCacheStats
+	}
+
+	// The default Flotilla templator, rendering templates with Djinn from the
+	// Flotilla Loader.
 	templator struct {
 		*djinn.Djinn
+		lock         sync.RWMutex
 		TemplateDirs []string
+		cache        *templateCache
+	}
+
+	// cachedLoader is the Loader of the default templator, keeping loaded
+	// templates in the templator cache.
+	cachedLoader struct {
+		*Loader
+		cache *templateCache
 	}
 
 	// The default templator loader
@@ -50,16 +70,39 @@ func (env *Env) TemplateDirs(dirs ...string) []string {
 	return storedirs
 }
 
+// AddTemplateNamespace adds any number of fs.FS to the named template namespace,
+// from which templates are loaded by names of the form "namespace:name". Use
+// os.DirFS for a directory of templates.
+func (env *Env) AddTemplateNamespace(namespace string, fsys ...fs.FS) {
+	env.tplnamespaces[namespace] = append(env.tplnamespaces[namespace], fsys...)
+}
+
 // NewTemplator returns a new instance of the default Flotilla templator.
+// Templates loaded for Djinn are cached in production, and in development
+// until a file in the template directories changes.
 func NewTemplator(env *Env) *templator {
 	j := &templator{Djinn: djinn.Empty()}
 	j.UpdateTemplateDirs(env.Store["TEMPLATE_DIRECTORIES"].List()...)
-	j.SetConf(djinn.Loaders(NewLoader(env)), djinn.TemplateFunctions(env.tplfunctions))
+	j.cache = newTemplateCache(env, j.ListTemplateDirs)
+	j.SetConf(djinn.Loaders(&cachedLoader{NewLoader(env), j.cache}), djinn.TemplateFunctions(env.tplfunctions))
 	return j
 }
 
 func (t *templator) ListTemplateDirs() []string {
-	return t.TemplateDirs
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return append([]string(nil), t.TemplateDirs...)
+}
+
+// CacheStats returns the TemplateCacheStats of loaded templates, by the names
+// listed by ListTemplates.
+func (t *templator) CacheStats() TemplateCacheStats {
+	return t.cache.Stats()
+}
+
+// Close stops any watcher invalidating loaded templates in development mode.
+func (t *templator) Close() error {
+	return t.cache.close()
 }
 
 func (t *templator) ListTemplates() []string {
@@ -72,11 +115,25 @@ func (t *templator) ListTemplates() []string {
 }
 
 func (t *templator) UpdateTemplateDirs(dirs ...string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	for _, dir := range dirs {
 		t.TemplateDirs = doAdd(dir, t.TemplateDirs)
 	}
 }
 
+// Load returns the named template from the cache, loading it where not cached.
+func (l *cachedLoader) Load(name string) (string, error) {
+	if l.cache == nil {
+		return l.Loader.Load(name)
+	}
+	src, err := l.cache.get(name, func() (interface{}, error) { return l.Loader.Load(name) })
+	if err != nil {
+		return "", err
+	}
+	return src.(string), nil
+}
+
 func NewLoader(env *Env) *Loader {
 	fl := &Loader{env: env, FileExtensions: []string{".html", ".dji"}}
 	return fl
@@ -97,48 +154,128 @@ func (fl *Loader) ValidExtension(ext string) bool {
 func (fl *Loader) AssetTemplates() []string {
 	var ret []string
 	for _, assetfs := range fl.env.Assets {
-		for _, f := range assetfs.AssetNames() {
-			if fl.ValidExtension(filepath.Ext(f)) {
-				ret = append(ret, f)
-			}
+		ret = append(ret, fl.assetTemplates(assetfs)...)
+	}
+	return ret
+}
+
+func (fl *Loader) assetTemplates(fsys fs.FS) []string {
+	var ret []string
+	for _, f := range assetNames(fsys) {
+		if fl.ValidExtension(filepath.Ext(f)) {
+			ret = append(ret, f)
 		}
 	}
 	return ret
 }
 
-// ListTemplates returns a string array of absolute template paths for all
-// templates dirs & assets matching valid extensions(default .html, .dji) and
-// associated with the flotilla loader.
+// dirTemplates returns the slash separated names, relative to dir, of templates
+// in dir and all of its subdirectories.
+func (fl *Loader) dirTemplates(dir string) []string {
+	var ret []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && fl.ValidExtension(filepath.Ext(p)) {
+			if rel, err := filepath.Rel(dir, p); err == nil {
+				ret = append(ret, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// ListTemplates returns a string array of the names of all templates, found
+// recursively in template dirs, assets & template namespaces, matching valid
+// extensions(default .html, .dji) and associated with the flotilla loader.
+// Names are slash separated, e.g. admin/users/list.html, and prefixed by any
+// namespace, e.g. admin:list.html. A name found more than once is listed
+// once, where Load will find it.
 func (fl *Loader) ListTemplates() interface{} {
 	var ret []string
+	seen := make(map[string]bool)
+	add := func(names ...string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				ret = append(ret, name)
+			}
+		}
+	}
 	for _, p := range fl.env.TemplateDirs() {
-		files, _ := ioutil.ReadDir(p)
-		for _, f := range files {
-			if fl.ValidExtension(filepath.Ext(f.Name())) {
-				ret = append(ret, fmt.Sprintf("%s/%s", p, f.Name()))
+		add(fl.dirTemplates(p)...)
+	}
+	add(fl.AssetTemplates()...)
+	var namespaces []string
+	for namespace := range fl.env.tplnamespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		for _, fsys := range fl.env.tplnamespaces[namespace] {
+			for _, name := range fl.assetTemplates(fsys) {
+				add(namespace + ":" + name)
 			}
 		}
 	}
-	ret = append(ret, fl.AssetTemplates()...)
 	return ret
 }
 
+// Load returns the content of the named template. A name without namespace is
+// looked for in each template dir, then in each of the App assets, in the
+// order they were added, with the first found used. In assets, the name is
+// looked for exactly under a directory named as a template dir, then as is. A name of the form
+// "namespace:name" is looked for only in the fs.FS of the namespace, in the
+// order they were added.
 func (fl *Loader) Load(name string) (string, error) {
+	if !fl.ValidExtension(filepath.Ext(name)) {
+		return "", newError("Template %s does not exist", name)
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		return fl.loadNamespaced(name[:i], name[i+1:])
+	}
+	clean, ok := templateName(name)
+	if !ok {
+		return "", newError("Template %s does not exist", name)
+	}
+	// existing template dirs
 	for _, p := range fl.env.TemplateDirs() {
-		f := filepath.Join(p, name)
-		if fl.ValidExtension(filepath.Ext(f)) {
-			// existing template dirs
-			if _, err := os.Stat(f); err == nil {
-				file, err := os.Open(f)
-				r, err := ioutil.ReadAll(file)
-				return string(r), err
-			}
-			// binary assets
-			if r, err := fl.env.Assets.Get(name); err == nil {
-				r, err := ioutil.ReadAll(r)
-				return string(r), err
-			}
+		f := filepath.Join(p, filepath.FromSlash(clean))
+		if _, err := os.Stat(f); err == nil {
+			r, err := ioutil.ReadFile(f)
+			return string(r), err
 		}
 	}
+	// assets
+	if r, err := fl.env.Assets.getIn(fl.env.TemplateDirs(), clean); err == nil {
+		defer r.Close()
+		r, err := ioutil.ReadAll(r)
+		return string(r), err
+	}
 	return "", newError("Template %s does not exist", name)
 }
+
+func (fl *Loader) loadNamespaced(namespace, name string) (string, error) {
+	clean, ok := templateName(name)
+	fsyss, exists := fl.env.tplnamespaces[namespace]
+	if !ok || !exists {
+		return "", newError("Template %s:%s does not exist", namespace, name)
+	}
+	for _, fsys := range fsyss {
+		if r, err := fs.ReadFile(fsys, clean); err == nil {
+			return string(r), nil
+		}
+	}
+	return "", newError("Template %s:%s does not exist", namespace, name)
+}
+
+// templateName cleans a slash separated template name, rejecting names
+// outside of the directory or fs.FS they are loaded from.
+func templateName(name string) (string, bool) {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	return clean, clean != ""
+}
@@ -0,0 +1,121 @@
+package flotilla
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// templateCache keeps templates by name until invalidated, as loaded for
+	// the default templator or as compiled by HTMLTemplator.
+	templateCache struct {
+		lock    sync.RWMutex
+		entries map[string]*templateCacheEntry
+		hits    int64
+		misses  int64
+		cleared time.Time
+		watcher *watcher
+	}
+
+	templateCacheEntry struct {
+		value  interface{}
+		loaded time.Time
+		hits   int64
+	}
+
+	// TemplateCacheStats reports the use of a Templator template cache.
+	TemplateCacheStats struct {
+		Enabled     bool
+		Watching    bool
+		Hits        int64
+		Misses      int64
+		Invalidated time.Time
+		Templates   []TemplateCacheEntryStats
+	}
+
+	// TemplateCacheEntryStats reports the use of a single cached template.
+	TemplateCacheEntryStats struct {
+		Name   string
+		Loaded time.Time
+		Hits   int64
+	}
+)
+
+// newTemplateCache returns the template cache for the Env mode, or nil where
+// templates are not cached. Templates are always cached in production. In
+// development they are cached until any file in dirs changes, watched from the
+// first use of the cache until closed, e.g. by App.Close.
+func newTemplateCache(env *Env, dirs func() []string) *templateCache {
+	switch {
+	case env.Mode.Production:
+		return &templateCache{entries: make(map[string]*templateCacheEntry)}
+	case env.Mode.Development:
+		c := &templateCache{entries: make(map[string]*templateCacheEntry)}
+		c.watcher = newWatcher(time.Second, dirs, c.invalidate)
+		return c
+	}
+	return nil
+}
+
+// get returns the cached template by name, or the result of load, cached when
+// without error.
+func (c *templateCache) get(name string, load func() (interface{}, error)) (interface{}, error) {
+	if c.watcher != nil {
+		c.watcher.Start()
+	}
+	c.lock.Lock()
+	if e, ok := c.entries[name]; ok {
+		e.hits++
+		c.hits++
+		c.lock.Unlock()
+		return e.value, nil
+	}
+	c.misses++
+	c.lock.Unlock()
+	value, err := load()
+	if err == nil {
+		c.lock.Lock()
+		c.entries[name] = &templateCacheEntry{value: value, loaded: time.Now()}
+		c.lock.Unlock()
+	}
+	return value, err
+}
+
+// close stops any watcher invalidating the cache, with nothing to stop for a
+// nil cache.
+func (c *templateCache) close() error {
+	if c != nil && c.watcher != nil {
+		c.watcher.Stop()
+	}
+	return nil
+}
+
+func (c *templateCache) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]*templateCacheEntry)
+	c.cleared = time.Now()
+}
+
+// Stats returns the TemplateCacheStats of the cache, with no stats for a nil
+// cache.
+func (c *templateCache) Stats() TemplateCacheStats {
+	if c == nil {
+		return TemplateCacheStats{}
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	s := TemplateCacheStats{
+		Enabled:     true,
+		Watching:    c.watcher != nil,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Invalidated: c.cleared,
+	}
+	for name, e := range c.entries {
+		s.Templates = append(s.Templates, TemplateCacheEntryStats{name, e.loaded, e.hits})
+	}
+	sort.Slice(s.Templates, func(i, j int) bool { return s.Templates[i].Name < s.Templates[j].Name })
+	return s
+}
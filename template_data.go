@@ -37,17 +37,20 @@ func TemplateData(ctx *Ctx, any interface{}) TData {
 	return td
 }
 
-// GetFlashMessages gets flash messages stored with TData by category.
-func (t TData) GetFlashMessages(categories ...string) []string {
-	var ret []string
-	if fls, ok := t["Flash"].(map[string]string); ok {
-		for k, v := range fls {
-			if existsIn(k, categories) {
-				ret = append(ret, v)
-			}
-		}
-	}
-	return ret
+// GetFlashMessages gets & consumes flash messages stored with TData in any of
+// the provided categories, or all categories if none are provided.
+func (t TData) GetFlashMessages(categories ...string) Flashes {
+	fls, _ := t["Flash"].(Flashes)
+	matched, rest := fls.split(categories)
+	t["Flash"] = rest
+	return matched
+}
+
+// PeekFlashMessages gets flash messages stored with TData as GetFlashMessages,
+// without consuming them.
+func (t TData) PeekFlashMessages(categories ...string) Flashes {
+	fls, _ := t["Flash"].(Flashes)
+	return fls.Filter(categories...)
 }
 
 func (t TData) UrlFor(route string, external bool, params ...string) string {
@@ -61,6 +64,32 @@ func (t TData) UrlFor(route string, external bool, params ...string) string {
 	return fmt.Sprintf("Unable to return a url from: %s, %s, external(%t)", route, params, external)
 }
 
+// Url returns the url of the named route as Ctx.UrlFor, from params given as a
+// single map or as key value pairs, e.g. {{.Url "user" "id" 7 "_anchor" "top"}}
+func (t TData) Url(route string, params ...interface{}) (string, error) {
+	if ctx, ok := t["Ctx"].(*Ctx); ok {
+		return ctx.UrlFor(route, params...)
+	}
+	return "", newError("unable to return a url from: %s, %v", route, params)
+}
+
+// StaticUrl returns a fingerprinted url for the requested static file.
+func (t TData) StaticUrl(requested string) string {
+	if ctx, ok := t["Ctx"].(*Ctx); ok {
+		return ctx.StaticUrl(requested)
+	}
+	return fmt.Sprintf("Unable to return a static url for: %s", requested)
+}
+
+// FieldError returns the message of the first validation error for the named
+// field, or an empty string.
+func (t TData) FieldError(name string) string {
+	if errs, ok := t["FieldErrors"].(FieldErrors); ok {
+		return errs.Get(name)
+	}
+	return ""
+}
+
 // HTML will call the context processor by name return html, html formatted error,
 // or html formatted notice that the processor could not return an html value.
 func (t TData) HTML(name string) template.HTML {
@@ -0,0 +1,200 @@
+package flotilla
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"path"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+var (
+	regExtends  = regexp.MustCompile(`^\s*\{\{-?\s*extends\s+"([^"]+)"\s*-?\}\}`)
+	regTemplate = regexp.MustCompile(`\{\{-?\s*(?:template|block)\s+"([^"]+)"`)
+)
+
+type (
+	// HTMLTemplator is a Templator using html/template, loading templates with
+	// the Flotilla Loader from template directories, assets & namespaces.
+	//
+	// A template beginning with {{extends "layout.html"}} is rendered as that
+	// layout, with any {{define}} in the template replacing the {{block}} of
+	// the same name in the layout. Templates named by {{template}} or {{block}}
+	// are loaded by name where not defined. Env template functions are
+	// available to all templates, and TData methods, e.g. {{.UrlFor "name"
+	// false}} or {{.HTML "processor"}}, are used as with the default templator.
+	HTMLTemplator struct {
+		once         sync.Once
+		lock         sync.RWMutex
+		env          *Env
+		loader       *Loader
+		cache        *templateCache
+		TemplateDirs []string
+	}
+
+	// envTemplator is implemented by a Templator made without an Env, which is
+	// provided by the Templating configuration.
+	envTemplator interface {
+		setEnv(*Env)
+	}
+)
+
+// NewHTMLTemplator returns a new HTMLTemplator. The env may be nil when the
+// HTMLTemplator is provided to an App with the Templating configuration, e.g.
+// Templating(NewHTMLTemplator(nil)). Compiled templates are cached as loaded
+// templates are by the default templator.
+func NewHTMLTemplator(env *Env) *HTMLTemplator {
+	return &HTMLTemplator{env: env}
+}
+
+func (h *HTMLTemplator) setEnv(env *Env) {
+	if h.env == nil {
+		h.env = env
+	}
+}
+
+func (h *HTMLTemplator) setup() {
+	h.once.Do(func() {
+		h.UpdateTemplateDirs(h.env.Store["TEMPLATE_DIRECTORIES"].List()...)
+		h.loader = NewLoader(h.env)
+		h.cache = newTemplateCache(h.env, h.ListTemplateDirs)
+	})
+}
+
+func (h *HTMLTemplator) ListTemplateDirs() []string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return append([]string(nil), h.TemplateDirs...)
+}
+
+func (h *HTMLTemplator) UpdateTemplateDirs(dirs ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, dir := range dirs {
+		h.TemplateDirs = doAdd(dir, h.TemplateDirs)
+	}
+}
+
+func (h *HTMLTemplator) ListTemplates() []string {
+	h.setup()
+	return h.loader.ListTemplates().([]string)
+}
+
+// CacheStats returns the TemplateCacheStats of compiled templates.
+func (h *HTMLTemplator) CacheStats() TemplateCacheStats {
+	h.setup()
+	return h.cache.Stats()
+}
+
+// Close stops any watcher invalidating compiled templates in development mode.
+func (h *HTMLTemplator) Close() error {
+	return h.cache.close()
+}
+
+// Render executes the named template with data, writing to w only when the
+// template executes without error.
+func (h *HTMLTemplator) Render(w io.Writer, name string, data interface{}) error {
+	h.setup()
+	return renderCompiled(w, h.cache, name, data, func() (*template.Template, error) {
+		return compileTemplate(h.loader, templateFuncs(h.env), name)
+	})
+}
+
+// renderCompiled executes the named template, compiled once & kept by a
+// non-nil cache, or compiled for every render otherwise, writing to w only
+// when the template executes without error.
+func renderCompiled(w io.Writer, c *templateCache, name string, data interface{}, compile func() (*template.Template, error)) error {
+	var t interface{}
+	var err error
+	if c != nil {
+		t, err = c.get(name, func() (interface{}, error) { return compile() })
+	} else {
+		t, err = compile()
+	}
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err = t.(*template.Template).Execute(&b, data); err != nil {
+		return err
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// templateFuncs returns the Env template functions usable by html/template,
+// with the extends function marking layouts.
+func templateFuncs(env *Env) template.FuncMap {
+	fns := template.FuncMap{"extends": func(string) string { return "" }}
+	for name, fn := range env.tplfunctions {
+		if isFunc(fn) && goodFunc(reflect.TypeOf(fn)) {
+			fns[name] = fn
+		}
+	}
+	return fns
+}
+
+// compileTemplate parses the named template with its chain of layouts, loaded
+// by the Loader, returning the template of the outermost layout.
+func compileTemplate(loader *Loader, funcs template.FuncMap, name string) (*template.Template, error) {
+	var chain []string
+	sources := make(map[string]string)
+	for current := name; current != ""; {
+		if _, seen := sources[current]; seen {
+			return nil, newError("template %s extends itself through %v", current, chain)
+		}
+		src, err := loader.Load(current)
+		if err != nil {
+			return nil, err
+		}
+		sources[current] = src
+		chain = append(chain, current)
+		current = ""
+		if m := regExtends.FindStringSubmatch(src); m != nil {
+			current = m[1]
+		}
+	}
+	layout := chain[len(chain)-1]
+	root, err := template.New(layout).Funcs(funcs).Parse(sources[layout])
+	if err != nil {
+		return nil, err
+	}
+	for i := len(chain) - 2; i >= 0; i-- {
+		if _, err := root.New(chain[i]).Parse(sources[chain[i]]); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseReferenced(loader, root, sources); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// parseReferenced loads & parses templates referenced by name that are not
+// otherwise defined in t.
+func parseReferenced(loader *Loader, t *template.Template, sources map[string]string) error {
+	pending := make([]string, 0, len(sources))
+	for _, src := range sources {
+		pending = append(pending, src)
+	}
+	for len(pending) > 0 {
+		src := pending[0]
+		pending = pending[1:]
+		for _, m := range regTemplate.FindAllStringSubmatch(src, -1) {
+			if t.Lookup(m[1]) != nil || !loader.ValidExtension(path.Ext(m[1])) {
+				continue
+			}
+			ref, err := loader.Load(m[1])
+			if err != nil {
+				continue
+			}
+			if _, err := t.New(m[1]).Parse(ref); err != nil {
+				return err
+			}
+			pending = append(pending, ref)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package flotilla
+
+import (
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	builtinvalidators = map[string]ValidatorFunc{
+		"required": validateRequired,
+		"min":      validateMin,
+		"max":      validateMax,
+		"len":      validateLen,
+		"regexp":   validateRegexp,
+		"oneof":    validateOneOf,
+		"email":    validateEmail,
+	}
+
+	validateRegexps = struct {
+		sync.RWMutex
+		compiled map[string]*regexp.Regexp
+	}{compiled: make(map[string]*regexp.Regexp)}
+)
+
+type (
+	// ValidatorFunc validates a field value against the param of its rule, e.g.
+	// "3" for min=3, returning an error describing an invalid value.
+	ValidatorFunc func(value interface{}, param string) error
+
+	// FieldError is a single failed validation rule of a struct field.
+	FieldError struct {
+		Field   string `json:"field"`
+		Name    string `json:"name"`
+		Rule    string `json:"rule"`
+		Param   string `json:"param,omitempty"`
+		Message string `json:"message"`
+	}
+
+	// FieldErrors collects the failed validation rules of a struct.
+	FieldErrors []*FieldError
+
+	validationRule struct {
+		name, param string
+	}
+)
+
+func (e *FieldError) Error() string {
+	return e.Name + " " + e.Message
+}
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Get returns the message of the first error for the named field, or an empty
+// string.
+func (e FieldErrors) Get(name string) string {
+	for _, err := range e {
+		if err.Name == name || err.Field == name {
+			return err.Message
+		}
+	}
+	return ""
+}
+
+// AddValidator adds a ValidatorFunc used by the rule name in validate tags,
+// replacing any builtin rule of the same name.
+func (env *Env) AddValidator(name string, fn ValidatorFunc) {
+	env.validators[name] = fn
+}
+
+func (env *Env) validator(name string) (ValidatorFunc, bool) {
+	if fn, ok := env.validators[name]; ok {
+		return fn, true
+	}
+	fn, ok := builtinvalidators[name]
+	return fn, ok
+}
+
+// parseRules parses a validate tag of comma separated rules, where a regexp
+// rule must be last as its pattern may contain commas, e.g.
+// "required,min=3,regexp=^[a-z,]+$"
+func parseRules(tag string) []validationRule {
+	var rules []validationRule
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			rules = append(rules, validationRule{name, param})
+		}
+	}
+	return rules
+}
+
+func fieldName(field reflect.StructField) string {
+	if name := field.Tag.Get("form"); name != "" && name != "-" {
+		return name
+	}
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// validateStruct validates the fields of a struct, and embedded structs or
+// non-nil pointers to structs, by the rules of their validate tags.
+func (env *Env) validateStruct(v reflect.Value) (FieldErrors, error) {
+	var errs FieldErrors
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			embedded, err := env.validateStruct(fv)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, embedded...)
+			continue
+		}
+		rules := parseRules(field.Tag.Get("validate"))
+		if len(rules) == 0 {
+			continue
+		}
+		var required bool
+		for _, rule := range rules {
+			required = required || rule.name == "required"
+		}
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if !required && fv.IsZero() {
+			continue
+		}
+		for _, rule := range rules {
+			fn, ok := env.validator(rule.name)
+			if !ok {
+				return nil, newError("unknown validation rule %q for field %s", rule.name, field.Name)
+			}
+			if err := fn(fv.Interface(), rule.param); err != nil {
+				errs = append(errs, &FieldError{field.Name, fieldName(field), rule.name, rule.param, err.Error()})
+				break
+			}
+		}
+	}
+	return errs, nil
+}
+
+func validate(ctx *Ctx, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return newError("cannot validate %T, not a struct", v)
+	}
+	errs, err := ctx.App.Env.validateStruct(rv)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		ret, err := ctx.Call("validationerrors", ctx, errs)
+		if err != nil {
+			return err
+		}
+		if err, ok := ret.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates the struct v by the validate tags of its fields, using
+// the Ctx validate function, e.g.
+//
+// 	type Signup struct {
+// 		Email string `form:"email" validate:"required,email"`
+// 		Name  string `form:"name" validate:"required,min=2,max=40"`
+// 		Plan  string `form:"plan" validate:"oneof=free pro"`
+// 		Code  string `form:"code" validate:"len=6,regexp=^[0-9]+$"`
+// 	}
+//
+// The builtin rules are required, min & max(the value of numbers, or the
+// length of strings, slices & maps), len(exact length), regexp, oneof(space
+// separated values), and email. Rules other than required apply only to
+// fields with a value. Further rules are added with the Validator
+// configuration. Failed rules are reported as FieldErrors by the Ctx
+// validationerrors function.
+func (ctx *Ctx) Validate(v interface{}) error {
+	ret, err := ctx.Call("validate", ctx, v)
+	if err != nil {
+		return err
+	}
+	if err, ok := ret.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// BindValid binds the request to v as Bind, and validates v as Validate.
+func (ctx *Ctx) BindValid(v interface{}) error {
+	if err := ctx.Bind(v); err != nil {
+		return err
+	}
+	return ctx.Validate(v)
+}
+
+// validationerrors reports FieldErrors by keeping them in Ctx.Data as
+// "FieldErrors", available to templates, and returning them.
+func validationerrors(ctx *Ctx, errs FieldErrors) error {
+	if ctx.Data != nil {
+		ctx.Data["FieldErrors"] = errs
+	}
+	return errs
+}
+
+func validateRequired(value interface{}, param string) error {
+	if v := reflect.ValueOf(value); !v.IsValid() || v.IsZero() {
+		return newError("is required")
+	}
+	return nil
+}
+
+// measure returns the value of a number, or the length of a string, slice,
+// array or map, for the min, max & len rules.
+func measure(value interface{}) (float64, bool, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true, true
+	case reflect.String:
+		return float64(len([]rune(v.String()))), false, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), false, true
+	}
+	return 0, false, false
+}
+
+func measured(value interface{}, param, rule string) (float64, float64, bool, error) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, false, newError("has an invalid %s rule %q", rule, param)
+	}
+	n, number, ok := measure(value)
+	if !ok {
+		return 0, 0, false, newError("cannot be measured by %s", rule)
+	}
+	return n, limit, number, nil
+}
+
+func validateMin(value interface{}, param string) error {
+	n, limit, number, err := measured(value, param, "min")
+	if err != nil {
+		return err
+	}
+	if n < limit {
+		if number {
+			return newError("must be at least %s", param)
+		}
+		return newError("must have a length of at least %s", param)
+	}
+	return nil
+}
+
+func validateMax(value interface{}, param string) error {
+	n, limit, number, err := measured(value, param, "max")
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		if number {
+			return newError("must be at most %s", param)
+		}
+		return newError("must have a length of at most %s", param)
+	}
+	return nil
+}
+
+func validateLen(value interface{}, param string) error {
+	n, limit, number, err := measured(value, param, "len")
+	if err != nil {
+		return err
+	}
+	if number || n != limit {
+		return newError("must have a length of %s", param)
+	}
+	return nil
+}
+
+func validateRegexp(value interface{}, param string) error {
+	validateRegexps.RLock()
+	re, ok := validateRegexps.compiled[param]
+	validateRegexps.RUnlock()
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(param); err != nil {
+			return newError("has an invalid regexp rule %q", param)
+		}
+		validateRegexps.Lock()
+		validateRegexps.compiled[param] = re
+		validateRegexps.Unlock()
+	}
+	s, ok := value.(string)
+	if !ok || !re.MatchString(s) {
+		return newError("does not match %s", param)
+	}
+	return nil
+}
+
+func validateOneOf(value interface{}, param string) error {
+	options := strings.Fields(param)
+	s := reflect.ValueOf(value)
+	for _, option := range options {
+		if s.Kind() == reflect.String && s.String() == option {
+			return nil
+		}
+		if n, number, ok := measure(value); ok && number {
+			if o, err := strconv.ParseFloat(option, 64); err == nil && o == n {
+				return nil
+			}
+		}
+	}
+	return newError("must be one of %s", strings.Join(options, ", "))
+}
+
+func validateEmail(value interface{}, param string) error {
+	s, ok := value.(string)
+	if ok {
+		if addr, err := mail.ParseAddress(s); err == nil && addr.Address == s {
+			return nil
+		}
+	}
+	return newError("must be a valid email address")
+}
@@ -0,0 +1,77 @@
+package flotilla
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// watcher polls directory trees, calling onChange when any file or directory
+// within them is added, removed, or modified.
+type watcher struct {
+	interval time.Duration
+	dirs     func() []string
+	onChange func()
+	last     uint64
+	start    sync.Once
+	started  bool
+	once     sync.Once
+	stop     chan struct{}
+}
+
+func newWatcher(interval time.Duration, dirs func() []string, onChange func()) *watcher {
+	w := &watcher{interval: interval, dirs: dirs, onChange: onChange, stop: make(chan struct{})}
+	w.last = w.signature()
+	return w
+}
+
+// signature hashes the path, size & modification time of every entry in the
+// watched directories.
+func (w *watcher) signature() uint64 {
+	h := fnv.New64a()
+	for _, dir := range w.dirs() {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				fmt.Fprintf(h, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return h.Sum64()
+}
+
+func (w *watcher) check() bool {
+	if sig := w.signature(); sig != w.last {
+		w.last = sig
+		w.onChange()
+		return true
+	}
+	return false
+}
+
+// Start polls for changes every interval in a new goroutine, until Stop. Only
+// the first Start polls, and not at all once stopped.
+func (w *watcher) Start() {
+	w.start.Do(func() {
+		w.started = true
+		go func() {
+			ticker := time.NewTicker(w.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					w.check()
+				case <-w.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+func (w *watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}